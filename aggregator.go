@@ -0,0 +1,189 @@
+package jas
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+//ErrorAggregator deduplicates InternalErrors by fingerprint of the error type and stack trace.
+//The first occurrence of an error is logged in full, then a summary with the number of occurrences is logged
+//when the window ends. Set its OnAppError method as Config option `OnAppError`, and set `InternalErrorLogger` to nil
+//to avoid logging each error twice.
+//It implements http.Handler to respond the current aggregates, which can be served on the router by *Router.Handle.
+//
+//	aggregator := jas.NewErrorAggregator(time.Minute, log.New(os.Stderr, "", 0))
+//	router.OnAppError = aggregator.OnAppError
+//	router.InternalErrorLogger = nil
+//	router.Handle("/debug/errors", aggregator)
+type ErrorAggregator struct {
+	Window time.Duration
+	Logger *log.Logger
+	mu     sync.Mutex
+	errors map[string]*ErrorAggregate
+	timer  *time.Timer //Scheduled to log the summaries when the earliest window ends, nil if none is pending.
+}
+
+//ErrorAggregate is the occurrences of InternalErrors with the same fingerprint.
+type ErrorAggregate struct {
+	Fingerprint string       `json:"fingerprint"`
+	Type        string       `json:"type"`
+	Error       string       `json:"error"` //The error string of the first occurrence.
+	Route       string       `json:"route"` //The route of the first occurrence.
+	Total       uint64       `json:"total"`
+	WindowCount uint64       `json:"windowCount"` //The number of occurrences in current window.
+	WindowStart time.Time    `json:"windowStart"`
+	FirstSeen   time.Time    `json:"firstSeen"`
+	LastSeen    time.Time    `json:"lastSeen"`
+	Stack       []StackFrame `json:"stack"`
+}
+
+func NewErrorAggregator(window time.Duration, logger *log.Logger) *ErrorAggregator {
+	return &ErrorAggregator{Window: window, Logger: logger, errors: map[string]*ErrorAggregate{}}
+}
+
+//Aggregate the error if it is an InternalError, other AppErrors are ignored.
+func (ea *ErrorAggregator) OnAppError(appErr AppError, ctx *Context) {
+	internalError, ok := appErr.(InternalError)
+	if !ok {
+		return
+	}
+	stack := internalError.Stack()
+	errType := reflect.TypeOf(internalError.Unwrap()).String()
+	fingerprint := errorFingerprint(errType, internalError.Error(), stack)
+	now := time.Now()
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+	aggregate := ea.errors[fingerprint]
+	if aggregate == nil {
+		aggregate = &ErrorAggregate{
+			Fingerprint: fingerprint,
+			Type:        errType,
+			Error:       internalError.Error(),
+			Route:       ctx.route,
+			WindowStart: now,
+			FirstSeen:   now,
+			Stack:       stack,
+		}
+		ea.errors[fingerprint] = aggregate
+		if ea.Logger != nil {
+			ea.Logger.Printf("%s %s", fingerprint, CommonErrorLogFormatter(newLogRecord(ctx, internalError, stack)))
+		}
+	} else if now.Sub(aggregate.WindowStart) >= ea.Window {
+		ea.logSummary(aggregate)
+		aggregate.WindowStart = now
+		aggregate.WindowCount = 0
+	}
+	aggregate.Total++
+	aggregate.WindowCount++
+	aggregate.LastSeen = now
+	if ea.timer == nil && summaryCount(aggregate) > 0 {
+		ea.timer = time.AfterFunc(aggregate.WindowStart.Add(ea.Window).Sub(now), ea.flushExpired)
+	}
+}
+
+//Log the summaries of the windows that have ended, then schedule the timer for the earliest pending window.
+func (ea *ErrorAggregator) flushExpired() {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+	ea.timer = nil
+	now := time.Now()
+	var next time.Time
+	for _, aggregate := range ea.errors {
+		if summaryCount(aggregate) == 0 {
+			continue
+		}
+		end := aggregate.WindowStart.Add(ea.Window)
+		if !now.Before(end) {
+			ea.logSummary(aggregate)
+			aggregate.WindowStart = now
+			aggregate.WindowCount = 0
+		} else if next.IsZero() || end.Before(next) {
+			next = end
+		}
+	}
+	if !next.IsZero() {
+		ea.timer = time.AfterFunc(next.Sub(now), ea.flushExpired)
+	}
+}
+
+//Log the summaries of the errors that occurred again in current window, it can be called before the server exits.
+func (ea *ErrorAggregator) Flush() {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+	if ea.timer != nil {
+		ea.timer.Stop()
+		ea.timer = nil
+	}
+	now := time.Now()
+	for _, aggregate := range ea.errors {
+		ea.logSummary(aggregate)
+		aggregate.WindowStart = now
+		aggregate.WindowCount = 0
+	}
+}
+
+//Get the number of occurrences to log in the summary of current window,
+//the first occurrence is not counted because it has been logged in full.
+func summaryCount(aggregate *ErrorAggregate) uint64 {
+	if aggregate.Total == aggregate.WindowCount {
+		return aggregate.WindowCount - 1
+	}
+	return aggregate.WindowCount
+}
+
+func (ea *ErrorAggregator) logSummary(aggregate *ErrorAggregate) {
+	count := summaryCount(aggregate)
+	if ea.Logger == nil || count == 0 {
+		return
+	}
+	ea.Logger.Printf("%s occurred %d more times since %s: %s",
+		aggregate.Fingerprint, count, aggregate.WindowStart.Format(timeFormat), aggregate.Error)
+}
+
+//Get a copy of the aggregates, sorted by total number of occurrences in descending order.
+func (ea *ErrorAggregator) Aggregates() []ErrorAggregate {
+	ea.mu.Lock()
+	aggregates := make([]ErrorAggregate, 0, len(ea.errors))
+	for _, aggregate := range ea.errors {
+		aggregates = append(aggregates, *aggregate)
+	}
+	ea.mu.Unlock()
+	sort.Slice(aggregates, func(i, j int) bool {
+		if aggregates[i].Total != aggregates[j].Total {
+			return aggregates[i].Total > aggregates[j].Total
+		}
+		return aggregates[i].Fingerprint < aggregates[j].Fingerprint
+	})
+	return aggregates
+}
+
+//Respond the aggregates in `{"data":[...],"error":null}` format.
+func (ea *ErrorAggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var response Response
+	response.Data = ea.Aggregates()
+	jsonBytes, _ := json.Marshal(response)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(jsonBytes)
+}
+
+//The error string is used instead of the stack if there is no stack,
+//e.g. the InternalError is made by struct literal rather than NewInternalError.
+func errorFingerprint(errType, errString string, stack []StackFrame) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(errType))
+	if len(stack) == 0 {
+		fmt.Fprintf(hash, "|%s", errString)
+	}
+	for _, frame := range stack {
+		fmt.Fprintf(hash, "|%s:%d", frame.Function, frame.Line)
+	}
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
@@ -2,16 +2,20 @@ package jas
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Response struct {
-	Data  interface{} `json:"data"`
-	Error interface{} `json:"error"`
+	Data    interface{} `json:"data"`
+	Error   interface{} `json:"error"`
+	Message string      `json:"message,omitempty"` //The localized error message, see Config option `MessageCatalog`.
 }
 
 //Context contains all the information for a single request.
@@ -27,12 +31,18 @@ type Context struct {
 	Data           interface{} //The data to be written after the resource method has returned.
 	UserId         int64
 	Id             int64
-	Extra          interface{} //Store extra data generated/used by hook functions, e.g. 'BeforeServe'.
+	Extra          interface{}  //Store extra data generated/used by hook functions, e.g. 'BeforeServe'.
+	Trace          TraceContext //Only parsed when Config option `Tracer` is set.
 	writer         io.Writer
 	responseWriter http.ResponseWriter
 	clientClosed   bool
+	streaming      bool
+	clientIP       string
+	locales        []string
 	written        int
 	config         *Config
+	startTime      time.Time
+	route          string
 	pathSegments   []string
 	gaps           []string
 }
@@ -59,6 +69,10 @@ func (ctx *Context) FlushData(data interface{}) (written int, err error) {
 	if ctx.written == 0 && ctx.Status != 200 {
 		ctx.responseWriter.WriteHeader(ctx.Status)
 	}
+	if !ctx.streaming && ctx.config.Metrics != nil {
+		ctx.streaming = true
+		ctx.config.Metrics.streamingStarted()
+	}
 	written, err = ctx.writer.Write(dataBytes)
 	if err != nil {
 		return
@@ -91,15 +105,27 @@ func (ctx *Context) deferredResponse() {
 		if handled, ok := x.(AppError); ok {
 			appErr = handled
 		} else {
-			appErr = NewInternalError(x)
+			internalError := NewInternalError(x)
+			internalError.StatusCode = ctx.config.internalErrorStatusCode()
+			appErr = internalError
 		}
 		ctx.Error = appErr
 	}
+	tracer := ctx.config.Tracer
+	if tracer != nil {
+		tracer.MethodReturned(ctx)
+	}
 	var resp Response
 	resp.Data = ctx.Data
 	if ctx.Error != nil {
 		ctx.Status = ctx.Error.Status()
-		resp.Error = ctx.Error.Message()
+		if detailed, ok := ctx.Error.(*DetailedRequestError); ok && detailed.StatusCode == 0 {
+			ctx.Status = ctx.config.requestErrorStatusCode()
+		}
+		resp.Error, resp.Message = errorResponse(ctx)
+		if tracer != nil {
+			tracer.OnAppError(ctx, ctx.Error)
+		}
 	}
 	var written int
 	if ctx.config.HijackWrite != nil {
@@ -107,6 +133,10 @@ func (ctx *Context) deferredResponse() {
 		written = ctx.config.HijackWrite(ctx.writer, ctx)
 	} else {
 		jsonBytes, _ := json.Marshal(resp)
+		if ctx.Error != nil && ctx.config.ProblemDetails && ctx.Callback == "" && ctx.written == 0 {
+			ctx.ResponseHeader.Set("Content-Type", "application/problem+json")
+			jsonBytes, _ = json.Marshal(newProblem(ctx))
+		}
 		if ctx.Callback != "" { // handle JSONP
 			if ctx.written == 0 {
 				ctx.ResponseHeader.Set("Content-Type", "application/javascript; charset=utf-8")
@@ -125,16 +155,44 @@ func (ctx *Context) deferredResponse() {
 			}
 		}
 	}
+	ctx.written += written
 	if ctx.Error != nil {
-		ctx.written += written
 		ctx.writer = nil
-		ctx.Error.Log(ctx)
-		if ctx.config.OnAppError != nil {
-			go ctx.config.OnAppError(ctx.Error, ctx)
+		appErr, config := ctx.Error, ctx.config
+		if !config.AsyncLog {
+			appErr.Log(ctx)
 		}
+		if config.AsyncLog || config.OnAppError != nil {
+			snapshot := ctx.snapshot()
+			config.dispatch(func() {
+				if config.AsyncLog {
+					appErr.Log(snapshot)
+				}
+				if config.OnAppError != nil {
+					config.OnAppError(appErr, snapshot)
+				}
+			})
+		}
+	}
+	if tracer != nil {
+		tracer.ResponseWritten(ctx)
 	}
 }
 
+//Make a copy of the context that is detached from the response and the request body,
+//so it can be used after the request has been served.
+func (ctx *Context) snapshot() *Context {
+	snapshot := *ctx
+	snapshot.Request = ctx.Request.WithContext(context.Background())
+	snapshot.Request.Body = http.NoBody
+	snapshot.Finder.req = snapshot.Request
+	snapshot.ResponseHeader = ctx.ResponseHeader.Clone()
+	snapshot.writer = nil
+	snapshot.responseWriter = nil
+	snapshot.clientClosed = true
+	return &snapshot
+}
+
 //Typically used in for loop condition.along with Flush.
 func (ctx *Context) ClientClosed() bool {
 	if ctx.clientClosed {
@@ -173,6 +231,63 @@ func (ctx *Context) GapSegment(key string) string {
 	return ""
 }
 
+//Get a Finder that only looks up the query parameters.
+func (ctx *Context) QueryFinder() Finder {
+	query := ctx.URL.Query()
+	return ctx.sourceFinder(func(key string) []string {
+		return query[key]
+	})
+}
+
+//Get a Finder that only looks up the post form parameters and json body.
+//Json body takes precedence over post form.
+func (ctx *Context) BodyFinder() Finder {
+	ctx.ParseForm()
+	finder := ctx.sourceFinder(func(key string) []string {
+		return ctx.PostForm[key]
+	})
+	finder.value, finder.err, finder.text = ctx.value, ctx.err, ctx.text
+	return finder
+}
+
+//Get a Finder that only looks up the request headers, the key is case insensitive.
+func (ctx *Context) HeaderFinder() Finder {
+	return ctx.sourceFinder(ctx.Header.Values)
+}
+
+//Get a Finder that only looks up the cookies.
+func (ctx *Context) CookieFinder() Finder {
+	return ctx.sourceFinder(func(key string) []string {
+		var values []string
+		for _, cookie := range ctx.Request.Cookies() {
+			if cookie.Name == key {
+				values = append(values, cookie.Value)
+			}
+		}
+		return values
+	})
+}
+
+//Get a Finder that only looks up the path, key "id" for the id segment and gap keys like ":username" or "username"
+//for the gap segments.
+func (ctx *Context) PathFinder() Finder {
+	return ctx.sourceFinder(func(key string) []string {
+		if key == "id" && ctx.Id != 0 {
+			return []string{strconv.FormatInt(ctx.Id, 10)}
+		}
+		for i, gap := range ctx.gaps {
+			if key != "" && (key == gap || ":"+key == gap) {
+				return []string{ctx.pathSegments[i+1]}
+			}
+		}
+		return nil
+	})
+}
+
+func (ctx *Context) sourceFinder(source paramSource) Finder {
+	return Finder{req: ctx.Request, config: ctx.config, source: source}
+}
+
 //It is an convenient method to validate and get the user id.
 func (ctx *Context) RequireUserId() int64 {
 	if ctx.UserId <= 0 {
@@ -185,11 +300,15 @@ func (ctx *Context) RequireUserId() int64 {
 
 //Unmarshal the request body into the interface.
 //It only works when you set Config option `DisableAutoUnmarshal` to true.
+//If the body has already been decoded in Finder, e.g. to validate the schema of the method, it is decoded from the Finder value.
 func (ctx *Context) Unmarshal(in interface{}) error {
 	if !ctx.config.DisableAutoUnmarshal {
 		panic("Should only call it when  'DisableAutoUnmarshal' is set to true")
 	}
 	if ctx.ContentLength > 0 && strings.Contains(ctx.Header.Get("Content-Type"), "application/json") {
+		if ctx.Finder.value != nil || ctx.Finder.err != nil {
+			return ctx.Finder.Decode(in)
+		}
 		decoder := json.NewDecoder(ctx.Body)
 		decoder.UseNumber()
 		return decoder.Decode(in)
@@ -198,13 +317,15 @@ func (ctx *Context) Unmarshal(in interface{}) error {
 }
 
 //If set Config option `DisableAutoUnmarshal` to true, you should call this method first before you can get body parameters in Finder methods..
+//The body is decoded by the decoder of its content type in Config option `BodyDecoders`.
 func (ctx *Context) UnmarshalInFinder() {
-	if ctx.value == nil && ctx.ContentLength > 0 && strings.Contains(ctx.Header.Get("Content-Type"), "application/json") {
-		var in interface{}
-		decoder := json.NewDecoder(ctx.Body)
-		decoder.UseNumber()
-		ctx.err = decoder.Decode(&in)
-		ctx.value = in
+	if ctx.value != nil || ctx.ContentLength <= 0 {
+		return
+	}
+	decoder, mediaType := ctx.Finder.config.bodyDecoder(ctx.Header.Get("Content-Type"))
+	if decoder != nil {
+		ctx.value, ctx.err = decoder(ctx.Request)
+		ctx.text = !isJsonMediaType(mediaType)
 	}
 }
 
@@ -0,0 +1,226 @@
+package jas
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//BodyDecoder decodes the request body to the generic value that Finder looks up, which is made of
+//map[string]interface{}, []interface{}, string, json.Number, bool and nil like json decoded with UseNumber.
+type BodyDecoder func(req *http.Request) (interface{}, error)
+
+//The body decoders keyed by media type, used for Config option `BodyDecoders` made by NewConfig.
+//Media types with "+json" suffix like "application/merge-patch+json" are decoded by the "application/json" decoder
+//if they are not registered.
+//"multipart/form-data" is not registered because the body would be read before the resource method runs,
+//which breaks streaming uploads with *http.Request.MultipartReader, register DecodeFormBody for it if needed.
+var DefaultBodyDecoders = map[string]BodyDecoder{
+	"application/json":                  DecodeJsonBody,
+	"application/xml":                   DecodeXmlBody,
+	"text/xml":                          DecodeXmlBody,
+	"application/x-www-form-urlencoded": DecodeFormBody,
+}
+
+const defaultMaxMemory = 32 << 20
+
+//The max nesting depth of xml elements, the same as the limit of encoding/json.
+const maxXmlDepth = 10000
+
+var errXmlDepth = errors.New("xml: exceeded max depth")
+
+func DecodeJsonBody(req *http.Request) (interface{}, error) {
+	var in interface{}
+	decoder := json.NewDecoder(req.Body)
+	decoder.UseNumber()
+	err := decoder.Decode(&in)
+	return in, err
+}
+
+//Decode the xml body, the root element is decoded to the value, child elements and attributes to the map entries.
+//Repeated child elements are decoded to a slice, elements that have neither child nor attribute to strings.
+//The text of elements that have children or attributes is put in the "#text" entry.
+//Elements nested deeper than 10000 levels are rejected.
+//
+//	<user id="1"><name>abc</name><tag>a</tag><tag>b</tag></user>
+//
+//is decoded to the same value as `{"id":"1","name":"abc","tag":["a","b"]}`.
+func DecodeXmlBody(req *http.Request) (interface{}, error) {
+	decoder := xml.NewDecoder(req.Body)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return decodeXmlElement(decoder, start, 1)
+		}
+	}
+}
+
+func decodeXmlElement(decoder *xml.Decoder, start xml.StartElement, depth int) (interface{}, error) {
+	if depth > maxXmlDepth {
+		return nil, errXmlDepth
+	}
+	m := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		m[attr.Name.Local] = attr.Value
+	}
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXmlElement(decoder, t, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			addValue(m, t.Name.Local, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(m) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				m["#text"] = s
+			}
+			return m, nil
+		}
+	}
+}
+
+//Decode the form body with bracket notation, e.g. "user[name]=abc&user[tags][]=a&user[tags][]=b&ids[0]=1"
+//is decoded to the same value as `{"user":{"name":"abc","tags":["a","b"]},"ids":["1"]}`.
+//Repeated keys are decoded to a slice. Multipart bodies are decoded too, but only the values, not the files.
+func DecodeFormBody(req *http.Request) (interface{}, error) {
+	err := req.ParseMultipartForm(defaultMaxMemory)
+	if err == http.ErrNotMultipart {
+		err = req.ParseForm()
+	}
+	if err != nil {
+		return nil, err
+	}
+	root := map[string]interface{}{}
+	for key, values := range req.PostForm {
+		segments := parseFormKey(key)
+		for _, value := range values {
+			insertFormValue(root, segments, value)
+		}
+	}
+	for key, value := range root {
+		root[key] = formSlices(value)
+	}
+	return root, nil
+}
+
+//Split the key like "a[b][0]" to ["a", "b", "0"], keys not in bracket notation are not split.
+func parseFormKey(key string) []string {
+	i := strings.IndexByte(key, '[')
+	if i <= 0 || !strings.HasSuffix(key, "]") {
+		return []string{key}
+	}
+	segments := []string{key[:i]}
+	for _, segment := range strings.Split(key[i+1:len(key)-1], "][") {
+		if strings.ContainsAny(segment, "[]") {
+			return []string{key}
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+func insertFormValue(node map[string]interface{}, segments []string, value string) {
+	for i, segment := range segments {
+		if segment == "" {
+			segment = strconv.Itoa(len(node))
+		}
+		if i == len(segments)-1 {
+			addValue(node, segment, value)
+			return
+		}
+		child, ok := node[segment].(map[string]interface{})
+		if !ok {
+			if _, exists := node[segment]; exists {
+				return
+			}
+			child = map[string]interface{}{}
+			node[segment] = child
+		}
+		node = child
+	}
+}
+
+//Convert the maps that have keys "0" to "n-1" to slices.
+func formSlices(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, child := range m {
+		m[key] = formSlices(child)
+	}
+	slice := make([]interface{}, len(m))
+	for i := range slice {
+		element, ok := m[strconv.Itoa(i)]
+		if !ok {
+			return m
+		}
+		slice[i] = element
+	}
+	return slice
+}
+
+//Add the value to the map, the values of the same key are put in a slice.
+func addValue(m map[string]interface{}, key string, value interface{}) {
+	existing, ok := m[key]
+	if !ok {
+		m[key] = value
+	} else if slice, ok := existing.([]interface{}); ok {
+		m[key] = append(slice, value)
+	} else {
+		m[key] = []interface{}{existing, value}
+	}
+}
+
+func isJsonMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+//Get the body decoder of the content type, return nil if there is none.
+func (config *Config) bodyDecoder(contentType string) (decoder BodyDecoder, mediaType string) {
+	mediaType, _, _ = mime.ParseMediaType(contentType)
+	decoders := DefaultBodyDecoders
+	if config != nil && config.BodyDecoders != nil {
+		decoders = config.BodyDecoders
+	}
+	decoder = decoders[mediaType]
+	if decoder == nil && strings.HasSuffix(mediaType, "+json") {
+		decoder = decoders["application/json"]
+	}
+	return
+}
+
+var textNumberRegexp = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+//Get the number of the value, strings are parsed if the body is not json.
+func (finder Finder) toNumber(value interface{}) (json.Number, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return v, true
+	case string:
+		if finder.text && textNumberRegexp.MatchString(v) {
+			return json.Number(v), true
+		}
+	}
+	return "", false
+}
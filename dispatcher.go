@@ -0,0 +1,169 @@
+package jas
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+//DropPolicy decides what to do when the queue of asynchronous error handlers is full.
+type DropPolicy int
+
+const (
+	DropNewest    DropPolicy = iota //Drop the error being dispatched.
+	DropOldest                      //Drop the oldest pending error to make room for the error being dispatched.
+	BlockWhenFull                   //Block the request until there is room in the queue.
+)
+
+const (
+	defaultAsyncWorkers   = 4
+	defaultAsyncQueueSize = 1024
+)
+
+//DispatchStats is the counters of the asynchronous error handlers.
+type DispatchStats struct {
+	Processed uint64
+	Dropped   uint64
+	Pending   int
+}
+
+//asyncDispatcher runs OnAppError and asynchronous AppError.Log with a bounded number of goroutines.
+//The goroutines are started on the first dispatch with the config options at that time.
+type asyncDispatcher struct {
+	config    *Config
+	startOnce sync.Once
+	mu        sync.RWMutex
+	closed    bool
+	queue     chan func()
+	wg        sync.WaitGroup
+	processed uint64
+	dropped   uint64
+}
+
+func newAsyncDispatcher(config *Config) *asyncDispatcher {
+	return &asyncDispatcher{config: config}
+}
+
+func (ad *asyncDispatcher) start() {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+	if ad.closed {
+		return
+	}
+	workers := ad.config.AsyncWorkers
+	if workers <= 0 {
+		workers = defaultAsyncWorkers
+	}
+	queueSize := ad.config.AsyncQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultAsyncQueueSize
+	}
+	ad.queue = make(chan func(), queueSize)
+	ad.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go ad.work()
+	}
+}
+
+func (ad *asyncDispatcher) work() {
+	defer ad.wg.Done()
+	for fn := range ad.queue {
+		ad.run(fn)
+	}
+}
+
+//Run the function, a panic in error handlers should not crash the server.
+func (ad *asyncDispatcher) run(fn func()) {
+	defer func() {
+		recover()
+		atomic.AddUint64(&ad.processed, 1)
+	}()
+	fn()
+}
+
+func (ad *asyncDispatcher) dispatch(fn func()) {
+	ad.startOnce.Do(ad.start)
+	ad.mu.RLock()
+	defer ad.mu.RUnlock()
+	if ad.closed {
+		atomic.AddUint64(&ad.dropped, 1)
+		return
+	}
+	switch ad.config.AsyncDropPolicy {
+	case BlockWhenFull:
+		ad.queue <- fn
+	case DropOldest:
+		for {
+			select {
+			case ad.queue <- fn:
+				return
+			default:
+			}
+			select {
+			case <-ad.queue:
+				atomic.AddUint64(&ad.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case ad.queue <- fn:
+		default:
+			atomic.AddUint64(&ad.dropped, 1)
+		}
+	}
+}
+
+//Stop accepting new errors and wait for the pending errors to be handled.
+func (ad *asyncDispatcher) close() {
+	ad.mu.Lock()
+	if ad.closed {
+		ad.mu.Unlock()
+		return
+	}
+	ad.closed = true
+	if ad.queue != nil {
+		close(ad.queue)
+	}
+	ad.mu.Unlock()
+	ad.wg.Wait()
+}
+
+func (ad *asyncDispatcher) stats() DispatchStats {
+	var stats DispatchStats
+	stats.Processed = atomic.LoadUint64(&ad.processed)
+	stats.Dropped = atomic.LoadUint64(&ad.dropped)
+	ad.mu.RLock()
+	if ad.queue != nil {
+		stats.Pending = len(ad.queue)
+	}
+	ad.mu.RUnlock()
+	return stats
+}
+
+//Run the function asynchronously with the dispatcher of the config.
+//The config of a router always has a dispatcher, the function is run synchronously for a config that is not used by any router.
+func (config *Config) dispatch(fn func()) {
+	if config.dispatcher == nil {
+		newAsyncDispatcher(config).run(fn)
+		return
+	}
+	config.dispatcher.dispatch(fn)
+}
+
+//Stop accepting new errors and wait for the pending OnAppError and asynchronous AppError.Log calls to finish.
+//It should be called after the http server has been shut down.
+//Routers constructed with the same config share the dispatcher, so it stops the error handlers of all of them,
+//call it after all of them have been shut down.
+func (router *Router) Close() {
+	if router.dispatcher != nil {
+		router.dispatcher.close()
+	}
+}
+
+//Get the counters of OnAppError and asynchronous AppError.Log calls.
+func (router *Router) DispatchStats() DispatchStats {
+	if router.dispatcher == nil {
+		return DispatchStats{}
+	}
+	return router.dispatcher.stats()
+}
@@ -100,6 +100,17 @@ Require methods will stop the execution in the method and respond an error messa
         _, _, _, _, _, _ = name, age, grade, err,password, email
     }
 
+To respond all the invalid parameters at once instead of the first one, use a Validator.
+Its Require methods collect the errors, Check will stop the execution if there is any error.
+
+    func (*Users) PostSignUp (ctx *jas.Context) {
+        v := ctx.Validate()
+        name := v.RequireString("name")
+        password := v.RequireStringLen(6, 60, "password")
+        v.Check()
+        _, _ = name, password
+    }
+
 Get json body parameter:
 Assume we have a request with json body
 
@@ -119,7 +130,15 @@ string argument to get value from json object, int argumnet to get value form js
         id:= ctx.RequirePositiveInt("photo", 1, "id") //200
     }
 
-If you want unmarshal json body to struct, the `DisableAutoUnmarshal` option must be set to true.
+Decode a subtree of the body to struct, or walk an array with Each:
+
+	ctx.Decode(&photo, "photo", 0)
+	ctx.Each(func(i int, f jas.Finder) error {
+		name, _ := f.FindString("name")
+		return nil
+	}, "photo")
+
+If you want unmarshal the whole json body to struct without decoding it in Finder, the `DisableAutoUnmarshal` option must be set to true.
 
 	router.DisableAutoUnmarshal = true
 
@@ -1,13 +1,13 @@
 package jas
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"reflect"
 	"runtime"
 	"strings"
-	"time"
 )
 
 var RequestErrorStatusCode = 400
@@ -24,8 +24,10 @@ var NotFoundError = RequestError{"Not Found", 404}
 var StackFormat = "%s:%d(0x%x);"
 
 const (
-	timeFormat = "02/Jan/2006:15:04:05 -0700"
-	logFormat  = "%v - %d [%v] \"%v %v %v\" %d %d \"%v\" \"%v\"\n"
+	timeFormat        = "02/Jan/2006:15:04:05 -0700"
+	logFormat         = "%v - %d [%v] \"%v %v %v\" %d %d \"%v\" \"%v\""
+	accessLogFormat   = "%v - %d [%v] \"%v %v %v\" %d %d"
+	combinedLogFormat = "%v \"%v\" \"%v\" \"%v\" %d %t"
 )
 
 //If RequestError and internalError is not sufficient for you application,
@@ -66,9 +68,84 @@ func (re RequestError) Message() string {
 }
 
 func (re RequestError) Log(context *Context) {
-	if context.config.RequestErrorLogger != nil {
-		doLog(context.config.RequestErrorLogger, context, re, "-")
+	doLog(context.config.RequestErrorLogger, slog.LevelWarn, context, re, nil)
+}
+
+//DetailedError is an AppError that carries machine-readable information about the error.
+//It is responded as an ErrorBody object instead of the Message() string.
+type DetailedError interface {
+	AppError
+
+	//The machine-readable error code, e.g. "nameInvalid".
+	Code() string
+
+	//The path of the failing field, e.g. "photo[0].name", empty if the error is not about a field.
+	Field() string
+
+	//Arbitrary details of the error, it will be marshaled to json.
+	Details() interface{}
+}
+
+//ErrorBody is the response of a DetailedError.
+type ErrorBody struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Field   string      `json:"field,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+//Problem is the RFC 7807 "application/problem+json" response of an AppError,
+//it is used when Config option `ProblemDetails` is set to true.
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     string      `json:"code,omitempty"`
+	Field    string      `json:"field,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+//DetailedRequestError is a DetailedError implementation which is logged the same way as RequestError.
+type DetailedRequestError struct {
+	ErrCode    string
+	Msg        string
+	FieldPath  string
+	Detail     interface{}
+	StatusCode int
+}
+
+func (dre *DetailedRequestError) Error() string {
+	return dre.ErrCode + ": " + dre.Msg
+}
+
+//Zero StatusCode is the request error status code of the router, see Config option `RequestErrorStatusCode`.
+func (dre *DetailedRequestError) Status() int {
+	if dre.StatusCode == 0 {
+		return RequestErrorStatusCode
 	}
+	return dre.StatusCode
+}
+
+func (dre *DetailedRequestError) Message() string {
+	return dre.Msg
+}
+
+func (dre *DetailedRequestError) Code() string {
+	return dre.ErrCode
+}
+
+func (dre *DetailedRequestError) Field() string {
+	return dre.FieldPath
+}
+
+func (dre *DetailedRequestError) Details() interface{} {
+	return dre.Detail
+}
+
+func (dre *DetailedRequestError) Log(context *Context) {
+	doLog(context.config.RequestErrorLogger, slog.LevelWarn, context, dre, nil)
 }
 
 //InternalError is an AppError implementation which
@@ -79,6 +156,13 @@ func (re RequestError) Log(context *Context) {
 type InternalError struct {
 	Err        error
 	StatusCode int
+	stack      *callStack
+}
+
+//The program counters captured by NewInternalError.
+//It is a pointer in InternalError to keep InternalError comparable.
+type callStack struct {
+	pcs []uintptr
 }
 
 func (ie InternalError) Status() int {
@@ -93,43 +177,38 @@ func (ie InternalError) Message() string {
 	return "InternalError"
 }
 
-func (ie InternalError) Log(context *Context) {
-	if context.config.InternalErrorLogger != nil {
-		buf := new(bytes.Buffer)
-		for i := 3; ; i++ {
-			pc, file, line, ok := runtime.Caller(i)
-			if !ok {
-				break
-			}
-			suffix := file[len(file)-10:]
-			if suffix == "me/panic.c" {
-				continue
-			}
-			if suffix == "t/value.go" {
-				break
-			}
-			fmt.Fprintf(buf, StackFormat, file, line, pc)
+//Return the wrapped error, so errors.Is and errors.As can be used on InternalError.
+func (ie InternalError) Unwrap() error {
+	return ie.Err
+}
+
+//Get the stack frames captured when the InternalError is made.
+//If it is made when a panic is recovered, the first frame is where the panic occurred.
+//The frames below the router ServeHTTP method are omitted.
+func (ie InternalError) Stack() []StackFrame {
+	if ie.stack == nil {
+		return nil
+	}
+	var stack []StackFrame
+	frames := runtime.CallersFrames(ie.stack.pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			stack = stack[:0]
+		} else if len(stack) > 0 || !strings.HasPrefix(frame.Function, "runtime.") {
+			stack = append(stack, StackFrame{frame.Function, frame.File, frame.Line, frame.PC})
+		}
+		if !more || frame.Function == serveHTTPFunction {
+			break
 		}
-		doLog(context.config.InternalErrorLogger, context, ie, buf.String())
 	}
+	return stack
 }
 
-func doLog(logger *log.Logger, context *Context, err error, stack string) {
-	errStr := err.Error()
-	errStr = strings.Replace(errStr, "\n", ";", -1)
-	logger.Printf(
-		logFormat,
-		context.RemoteAddr,
-		context.UserId,
-		time.Now().Format(timeFormat),
-		context.Method,
-		context.RequestURI,
-		context.Proto,
-		context.Status,
-		context.written,
-		errStr,
-		stack,
-	)
+var serveHTTPFunction = reflect.TypeOf(Router{}).PkgPath() + ".(*Router).ServeHTTP"
+
+func (ie InternalError) Log(context *Context) {
+	doLog(context.config.InternalErrorLogger, slog.LevelError, context, ie, ie.Stack())
 }
 
 //Make an RequestError with message which will be sent to the client.
@@ -137,11 +216,67 @@ func NewRequestError(message string) RequestError {
 	return RequestError{message, RequestErrorStatusCode}
 }
 
-//Wrap an error to InternalError
+//Make a DetailedRequestError with a machine-readable code and a human readable message.
+//Set the FieldPath and Detail fields to describe the failing field.
+//The status code is left zero, so the request error status code of the router that responds it is used.
+func NewDetailedRequestError(code, message string) *DetailedRequestError {
+	return &DetailedRequestError{ErrCode: code, Msg: message}
+}
+
+//Get the "error" value of the response, an ErrorBody for DetailedError, the Message() string for other AppError.
+//The localized message is returned along with the Message() string, it is empty if not localized.
+func errorResponse(ctx *Context) (errValue interface{}, localized string) {
+	if detailed, ok := ctx.Error.(DetailedError); ok {
+		body := ErrorBody{detailed.Code(), detailed.Message(), detailed.Field(), detailed.Details()}
+		if message, ok := ctx.localize(body.Code); ok {
+			body.Message = message
+		}
+		if fieldErrors, ok := body.Details.([]ErrorBody); ok {
+			localizedErrors := make([]ErrorBody, len(fieldErrors))
+			for i, fieldError := range fieldErrors {
+				localizedErrors[i] = fieldError
+				if message, ok := ctx.localize(fieldError.Code); ok {
+					localizedErrors[i].Message = message
+				}
+			}
+			body.Details = localizedErrors
+		}
+		return body, ""
+	}
+	message := ctx.Error.Message()
+	localized, _ = ctx.localize(message)
+	return message, localized
+}
+
+func newProblem(ctx *Context) Problem {
+	problem := Problem{Type: "about:blank", Status: ctx.Status}
+	problem.Title = http.StatusText(ctx.Status)
+	problem.Detail = ctx.Error.Message()
+	problem.Instance = ctx.URL.Path
+	if detailed, ok := ctx.Error.(DetailedError); ok {
+		problem.Code = detailed.Code()
+		if message, ok := ctx.localize(problem.Code); ok {
+			problem.Detail = message
+		}
+		problem.Field = detailed.Field()
+		problem.Details = detailed.Details()
+	} else if _, ok := ctx.Error.(InternalError); !ok {
+		problem.Code = ctx.Error.Message()
+		if message, ok := ctx.localize(problem.Code); ok {
+			problem.Detail = message
+		}
+	}
+	return problem
+}
+
+//Wrap an error to InternalError, the stack trace is captured where it is called.
+//Call it in the deferred function that recovers a panic to capture where the panic occurred.
 func NewInternalError(err interface{}) InternalError {
 	e, ok := err.(error)
 	if !ok {
 		e = errors.New(fmt.Sprint(err))
 	}
-	return InternalError{e, InternalErrorStatusCode}
+	stack := &callStack{make([]uintptr, 64)}
+	stack.pcs = stack.pcs[:runtime.Callers(2, stack.pcs)]
+	return InternalError{Err: e, StatusCode: InternalErrorStatusCode, stack: stack}
 }
@@ -5,13 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 //Finder is a accessor and validator with an unified interface to get parameters from both http request form and json body.
-//Form parameters take precedence over request json body.
+//Form parameters take precedence over request json body, unless Config option `BodyOverForm` is set.
+//Use the Finders returned by *Context.QueryFinder, BodyFinder, HeaderFinder, CookieFinder and PathFinder
+//to get parameters from a single source.
 
 //Finder can also be used for json data only, *http.Request is optional.
 //But then you should not call any "Require" methods, those should only be used to get http request parameters.
@@ -21,11 +28,18 @@ import (
 
 //All the "Find" methods return error, All the "Require" methods do panic with RequestError when error occured.
 type Finder struct {
-	value interface{}
-	err   error
-	req   *http.Request
+	value  interface{}
+	err    error
+	req    *http.Request
+	config *Config
+	path   []interface{} //The paths from the root value, used in error messages.
+	source paramSource   //Used instead of the request form if set.
+	text   bool          //Parse numbers and booleans from strings, set if the body is decoded from xml or form.
 }
 
+//paramSource gets all the values of the key from a single source of the request, like query or header.
+type paramSource func(key string) []string
+
 var WrongTypeError = errors.New("jas.Finder: wrong type")
 var IndexOutOfBoundError = errors.New("jas.Finder: index out of bound")
 var EntryNotExistsError = errors.New("jas.Finder: entry not exists")
@@ -38,12 +52,24 @@ var TooShortError = errors.New("jas.Finder: string too short")
 var TooLongError = errors.New("jas.Finder: string too long")
 var NotPositiveError = errors.New("jas.Finder: not positive")
 var DoNotMatchError = errors.New("jas.Finder: do not match")
+var OutOfRangeError = errors.New("jas.Finder: out of range")
 
 var InvalidErrorFormat = "%vInvalid"
 var NotPositiveErrorFormat = "%vNotPositive"
 var TooShortErrorFormat = "%vTooShort"
 var TooLongErrorFormat = "%vTooLong"
+var OutOfRangeErrorFormat = "%vOutOfRange"
 var MalformedJsonBody = "MalformedJsonBody"
+var MissingJsonBody = "MissingJsonBody"
+
+//The kinds of Finder errors, used as index of the formats returned by *Config.finderErrorFormats.
+const (
+	invalidFormat = iota
+	notPositiveFormat
+	tooShortFormat
+	tooLongFormat
+	outOfRangeFormat
+)
 
 func (finder Finder) FindString(paths ...interface{}) (string, error) {
 	if s := finder.findFormString(paths...); s != "" {
@@ -63,6 +89,7 @@ func (finder Finder) FindString(paths ...interface{}) (string, error) {
 }
 
 // Looks up the given path and returns a default value if not present.
+// Empty string and null are also treated as not present, use FindNullableString to tell them apart.
 func (finder Finder) FindOptionalString(val string, paths ...interface{}) (string, error) {
 	s, err := finder.FindString(paths...)
 	if err != nil {
@@ -134,7 +161,7 @@ func (finder Finder) FindSlice(paths ...interface{}) ([]interface{}, error) {
 func (finder Finder) RequireSlice(paths ...interface{}) []interface{} {
 	s, err := finder.FindSlice(paths...)
 	if err != nil {
-		doPanic(InvalidErrorFormat, paths...)
+		finder.doPanic(invalidFormat, paths...)
 	}
 	return s
 }
@@ -142,10 +169,10 @@ func (finder Finder) RequireSlice(paths ...interface{}) []interface{} {
 func (finder Finder) RequireStringLen(min, max int, paths ...interface{}) string {
 	s := finder.RequireString(paths...)
 	if len(s) < min {
-		doPanic(TooShortErrorFormat, paths...)
+		finder.doPanic(tooShortFormat, paths...)
 	}
 	if len(s) >= max {
-		doPanic(TooLongErrorFormat, paths...)
+		finder.doPanic(tooLongFormat, paths...)
 	}
 	return s
 }
@@ -157,10 +184,10 @@ func (finder Finder) RequireStringRuneLen(min, max int, paths ...interface{}) st
 		count++
 	}
 	if count < min {
-		doPanic(TooShortErrorFormat, paths...)
+		finder.doPanic(tooShortFormat, paths...)
 	}
 	if count >= max {
-		doPanic(TooLongErrorFormat, paths...)
+		finder.doPanic(tooLongFormat, paths...)
 	}
 	return s
 }
@@ -168,7 +195,7 @@ func (finder Finder) RequireStringRuneLen(min, max int, paths ...interface{}) st
 func (finder Finder) RequireStringMatch(reg *regexp.Regexp, paths ...interface{}) string {
 	s := finder.RequireString(paths...)
 	if !reg.MatchString(s) {
-		doPanic(InvalidErrorFormat, paths...)
+		finder.doPanic(invalidFormat, paths...)
 	}
 	return s
 }
@@ -190,7 +217,7 @@ func (finder Finder) FindMap(paths ...interface{}) (map[string]interface{}, erro
 func (finder Finder) RequireMap(paths ...interface{}) map[string]interface{} {
 	m, err := finder.FindMap(paths...)
 	if err != nil {
-		doPanic(InvalidErrorFormat, paths...)
+		finder.doPanic(invalidFormat, paths...)
 	}
 	return m
 }
@@ -198,20 +225,22 @@ func (finder Finder) RequireMap(paths ...interface{}) map[string]interface{} {
 func (finder Finder) RequireString(paths ...interface{}) string {
 	s, err := finder.FindString(paths...)
 	if err != nil {
-		doPanic(InvalidErrorFormat, paths...)
+		finder.doPanic(invalidFormat, paths...)
 	}
 	return s
 }
 
 func (finder Finder) FindInt(paths ...interface{}) (int64, error) {
 	if s := finder.findFormString(paths...); s != "" {
-		return strconv.ParseInt(s, 10, 64)
+		integer, err := strconv.ParseInt(s, 10, 64)
+		return integer, numberError(err)
 	}
 	num, err := finder.findNumber(paths...)
 	if err != nil {
 		return 0, err
 	}
-	return num.Int64()
+	integer, err := num.Int64()
+	return integer, numberError(err)
 }
 
 func (finder Finder) FindPositiveInt(paths ...interface{}) (int64, error) {
@@ -228,7 +257,7 @@ func (finder Finder) FindPositiveInt(paths ...interface{}) (int64, error) {
 func (finder Finder) RequireInt(paths ...interface{}) int64 {
 	i, err := finder.FindInt(paths...)
 	if err != nil {
-		doPanic(InvalidErrorFormat, paths...)
+		finder.doPanic(requireFormat(err), paths...)
 	}
 	return i
 }
@@ -236,26 +265,28 @@ func (finder Finder) RequireInt(paths ...interface{}) int64 {
 func (finder Finder) RequirePositiveInt(paths ...interface{}) int64 {
 	i := finder.RequireInt(paths...)
 	if i <= 0 {
-		doPanic(NotPositiveErrorFormat, paths...)
+		finder.doPanic(notPositiveFormat, paths...)
 	}
 	return i
 }
 
 func (finder Finder) FindFloat(paths ...interface{}) (float64, error) {
 	if s := finder.findFormString(paths...); s != "" {
-		return strconv.ParseFloat(s, 64)
+		f, err := strconv.ParseFloat(s, 64)
+		return f, numberError(err)
 	}
 	num, err := finder.findNumber(paths...)
 	if err != nil {
 		return 0, err
 	}
-	return num.Float64()
+	f, err := num.Float64()
+	return f, numberError(err)
 }
 
 func (finder Finder) RequireFloat(paths ...interface{}) float64 {
 	f, err := finder.FindFloat(paths...)
 	if err != nil {
-		doPanic(InvalidErrorFormat, paths...)
+		finder.doPanic(requireFormat(err), paths...)
 	}
 	return f
 }
@@ -263,9 +294,9 @@ func (finder Finder) RequireFloat(paths ...interface{}) float64 {
 func (finder Finder) RequirePositiveFloat(paths ...interface{}) float64 {
 	f, err := finder.FindFloat(paths...)
 	if err != nil {
-		doPanic(InvalidErrorFormat, paths...)
+		finder.doPanic(requireFormat(err), paths...)
 	} else if f < 0 {
-		doPanic(NotPositiveErrorFormat, paths...)
+		finder.doPanic(notPositiveFormat, paths...)
 	}
 	return f
 }
@@ -281,9 +312,203 @@ func (finder Finder) FindBool(paths ...interface{}) (bool, error) {
 	if b, ok := finder.value.(bool); ok {
 		return b, nil
 	}
+	if s, ok := finder.value.(string); ok && finder.text {
+		return strconv.ParseBool(s)
+	}
 	return false, WrongTypeError
 }
 
+//Get the time of RFC 3339 string like "2006-01-02T15:04:05Z" or unix timestamp in seconds like 1136214245.
+func (finder Finder) FindTime(paths ...interface{}) (time.Time, error) {
+	s, err := finder.findText(paths...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return time.Time{}, WrongTypeError
+		}
+		integer, fraction := math.Modf(seconds)
+		return time.Unix(int64(integer), int64(fraction*1e9)), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func (finder Finder) RequireTime(paths ...interface{}) time.Time {
+	t, err := finder.FindTime(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	return t
+}
+
+//Get the duration of string like "1h30m", or number of seconds like 90 or 1.5.
+func (finder Finder) FindDuration(paths ...interface{}) (time.Duration, error) {
+	s, err := finder.findText(paths...)
+	if err != nil {
+		return 0, err
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(seconds) || math.Abs(seconds) > math.MaxInt64/float64(time.Second) {
+		return 0, OutOfRangeError
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (finder Finder) RequireDuration(paths ...interface{}) time.Duration {
+	d, err := finder.FindDuration(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	return d
+}
+
+//Get the integer in range [min, max], both min and max are inclusive.
+func (finder Finder) FindIntRange(min, max int64, paths ...interface{}) (int64, error) {
+	integer, err := finder.FindInt(paths...)
+	if err != nil {
+		return integer, err
+	}
+	if integer < min || integer > max {
+		return integer, OutOfRangeError
+	}
+	return integer, nil
+}
+
+func (finder Finder) RequireIntRange(min, max int64, paths ...interface{}) int64 {
+	i := finder.RequireInt(paths...)
+	if i < min || i > max {
+		finder.doPanic(outOfRangeFormat, paths...)
+	}
+	return i
+}
+
+//Get the string that is one of the allowed values.
+func (finder Finder) FindEnum(allowed []string, paths ...interface{}) (string, error) {
+	s, err := finder.FindString(paths...)
+	if err != nil {
+		return s, err
+	}
+	for _, value := range allowed {
+		if s == value {
+			return s, nil
+		}
+	}
+	return s, DoNotMatchError
+}
+
+func (finder Finder) RequireEnum(allowed []string, paths ...interface{}) string {
+	s, err := finder.FindEnum(allowed, paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	return s
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+//Get the UUID in canonical form like "f47ac10b-58cc-4372-a567-0e02b2c3d479", it is returned in lower case.
+func (finder Finder) FindUUID(paths ...interface{}) (string, error) {
+	s, err := finder.FindString(paths...)
+	if err != nil {
+		return s, err
+	}
+	if err = validateUUID(s); err != nil {
+		return s, err
+	}
+	return strings.ToLower(s), nil
+}
+
+func (finder Finder) RequireUUID(paths ...interface{}) string {
+	s, err := finder.FindUUID(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	return s
+}
+
+//Get the bare email address like "gopher@example.com", address with name like "Gopher <gopher@example.com>" is invalid.
+func (finder Finder) FindEmail(paths ...interface{}) (string, error) {
+	s, err := finder.FindString(paths...)
+	if err != nil {
+		return s, err
+	}
+	return s, validateEmail(s)
+}
+
+func (finder Finder) RequireEmail(paths ...interface{}) string {
+	s, err := finder.FindEmail(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	return s
+}
+
+//Get the absolute URL that has scheme and host, like "https://example.com/path".
+func (finder Finder) FindURL(paths ...interface{}) (*url.URL, error) {
+	s, err := finder.FindString(paths...)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, DoNotMatchError
+	}
+	return u, nil
+}
+
+func (finder Finder) RequireURL(paths ...interface{}) *url.URL {
+	u, err := finder.FindURL(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	return u
+}
+
+//Get the list of strings from repeated form values like "tag=a&tag=b" or json array like `["a","b"]`.
+//Form values are split by Config option `ListSeparator` if it is set.
+func (finder Finder) FindStrings(paths ...interface{}) ([]string, error) {
+	strs, _, err := finder.findStrings(paths...)
+	return strs, err
+}
+
+//Errors of invalid elements contain the index, e.g. "tags[1]Invalid".
+func (finder Finder) RequireStrings(paths ...interface{}) []string {
+	strs, index, err := finder.findStrings(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, elementPath(paths, index)...)
+	}
+	return strs
+}
+
+//Get the list of integers from repeated form values like "id=1&id=2" or json array like `[1,2]`.
+//Form values are split by Config option `ListSeparator` if it is set.
+func (finder Finder) FindInts(paths ...interface{}) ([]int64, error) {
+	ints, _, err := finder.findInts(paths...)
+	return ints, err
+}
+
+//Errors of invalid elements contain the index, e.g. "ids[1]Invalid".
+func (finder Finder) RequireInts(paths ...interface{}) []int64 {
+	ints, index, err := finder.findInts(paths...)
+	if err != nil {
+		finder.doPanic(requireFormat(err), elementPath(paths, index)...)
+	}
+	return ints
+}
+
 // return the length of []interface or map[string]interface{}
 // return -1 if the value not found or has wrong type.
 func (finder Finder) Len(paths ...interface{}) int {
@@ -300,8 +525,62 @@ func (finder Finder) Len(paths ...interface{}) int {
 	return -1
 }
 
+//Call the function with the index and the Finder of each element of the array in order.
+//It stops and returns the error if the function returns an error.
+func (finder Finder) Each(fn func(i int, f Finder) error, paths ...interface{}) error {
+	finder = finder.FindChild(paths...)
+	if finder.err != nil {
+		return finder.err
+	}
+	slice, ok := finder.value.([]interface{})
+	if !ok {
+		if finder.text {
+			return fn(0, finder)
+		}
+		return WrongTypeError
+	}
+	for i := range slice {
+		if err := fn(i, finder.FindChild(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Get the sorted keys of the object.
+func (finder Finder) Keys(paths ...interface{}) ([]string, error) {
+	m, err := finder.FindMap(paths...)
+	if err != nil && err != EmptyMapError {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+//Decode the value into v like json.Unmarshal, numbers decoded into interface{} are json.Number.
+//It works without setting Config option `DisableAutoUnmarshal`.
+//Numbers and booleans in xml and form bodies are strings, so the struct fields need the ",string" json tag option.
+func (finder Finder) Decode(v interface{}, paths ...interface{}) error {
+	finder = finder.FindChild(paths...)
+	if finder.err != nil {
+		return finder.err
+	}
+	data, err := json.Marshal(finder.value)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
 func (finder Finder) FindChild(paths ...interface{}) Finder {
-	finder.req = nil
+	finder.req, finder.source = nil, nil
+	finder.path = appendPath(finder.path, paths...)
 	if finder.value == nil {
 		finder.err = NullValueError
 		return finder
@@ -380,31 +659,184 @@ func (finder Finder) findNumber(paths ...interface{}) (json.Number, error) {
 	if finder.err != nil {
 		return "", finder.err
 	}
-	if num, ok := finder.value.(json.Number); ok {
+	if num, ok := finder.toNumber(finder.value); ok {
 		return num, nil
 	}
 	return "", WrongTypeError
 }
 
-func doPanic(format string, paths ...interface{}) {
-	keyPath := "value"
-	if len(paths) > 0 {
-		lastPath := paths[len(paths)-1]
-		if s, ok := lastPath.(string); ok {
-			keyPath = s
+//Get the string or the number as string.
+func (finder Finder) findText(paths ...interface{}) (string, error) {
+	if s := finder.findFormString(paths...); s != "" {
+		return s, nil
+	}
+	finder = finder.FindChild(paths...)
+	if finder.err != nil {
+		return "", finder.err
+	}
+	switch value := finder.value.(type) {
+	case string:
+		if value == "" {
+			return value, EmptyStringError
 		}
+		return value, nil
+	case json.Number:
+		return value.String(), nil
 	}
-	requestErrorString := fmt.Sprintf(format, keyPath)
-	requerstError := NewRequestError(requestErrorString)
+	return "", WrongTypeError
+}
+
+//Get the strings and the index of the first invalid element, the index is -1 if no element is invalid.
+func (finder Finder) findStrings(paths ...interface{}) ([]string, int, error) {
+	if values := finder.findFormStrings(paths...); values != nil {
+		for i, s := range values {
+			if s == "" {
+				return nil, i, EmptyStringError
+			}
+		}
+		return values, -1, nil
+	}
+	slice, err := finder.findList(paths...)
+	if err != nil {
+		return nil, -1, err
+	}
+	strs := make([]string, len(slice))
+	for i, element := range slice {
+		s, ok := element.(string)
+		if !ok {
+			return nil, i, WrongTypeError
+		}
+		if s == "" {
+			return nil, i, EmptyStringError
+		}
+		strs[i] = s
+	}
+	return strs, -1, nil
+}
+
+//Get the integers and the index of the first invalid element, the index is -1 if no element is invalid.
+func (finder Finder) findInts(paths ...interface{}) ([]int64, int, error) {
+	if values := finder.findFormStrings(paths...); values != nil {
+		ints := make([]int64, len(values))
+		for i, s := range values {
+			integer, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, i, numberError(err)
+			}
+			ints[i] = integer
+		}
+		return ints, -1, nil
+	}
+	slice, err := finder.findList(paths...)
+	if err != nil {
+		return nil, -1, err
+	}
+	ints := make([]int64, len(slice))
+	for i, element := range slice {
+		num, ok := finder.toNumber(element)
+		if !ok {
+			return nil, i, WrongTypeError
+		}
+		integer, err := num.Int64()
+		if err != nil {
+			return nil, i, numberError(err)
+		}
+		ints[i] = integer
+	}
+	return ints, -1, nil
+}
+
+//Get the slice, a single value is a slice of one element if the body is decoded from xml or form,
+//because there is no way to tell a list of one element from a single value in them.
+func (finder Finder) findList(paths ...interface{}) ([]interface{}, error) {
+	slice, err := finder.FindSlice(paths...)
+	if err == WrongTypeError && finder.text {
+		return []interface{}{finder.FindChild(paths...).value}, nil
+	}
+	return slice, err
+}
+
+func elementPath(paths []interface{}, index int) []interface{} {
+	if index < 0 {
+		return paths
+	}
+	return appendPath(paths, index)
+}
+
+func (finder Finder) doPanic(formatKind int, paths ...interface{}) {
+	format := finder.config.finderErrorFormats()[formatKind]
+	requestErrorString := fmt.Sprintf(format, finder.fieldName(paths...))
+	requerstError := RequestError{requestErrorString, finder.config.requestErrorStatusCode()}
 	panic(requerstError)
 }
 
+//Get the full path of the field used in error messages, e.g. "photo[0].name".
+func (finder Finder) fieldName(paths ...interface{}) string {
+	if len(finder.path)+len(paths) == 0 {
+		return "value"
+	}
+	return FormatPath(appendPath(finder.path, paths...)...)
+}
+
 func (finder Finder) findFormString(paths ...interface{}) string {
-	if finder.req != nil && len(paths) == 1 {
-		key, ok := paths[0].(string)
-		if ok {
-			return finder.req.FormValue(key)
+	key, ok := finder.formKey(paths...)
+	if !ok {
+		return ""
+	}
+	if finder.source != nil {
+		if values := finder.source(key); len(values) > 0 {
+			return values[0]
 		}
+		return ""
+	}
+	return finder.req.FormValue(key)
+}
+
+//Get the key to look up in the form, return false if the paths should only be looked up in json body.
+//Json body takes precedence if it has the key and the Finder is made by BodyFinder or Config option `BodyOverForm` is set.
+func (finder Finder) formKey(paths ...interface{}) (string, bool) {
+	if (finder.req == nil && finder.source == nil) || len(paths) != 1 {
+		return "", false
+	}
+	key, ok := paths[0].(string)
+	if !ok {
+		return "", false
+	}
+	if (finder.source != nil || finder.config.bodyOverForm()) && finder.value != nil {
+		if _, ok := finder.value.(map[string]interface{})[key]; ok {
+			return "", false
+		}
+	}
+	return key, true
+}
+
+//Get all the form values of the key split by Config option `ListSeparator`.
+//Return nil if all the values are empty, so the json body is looked up.
+func (finder Finder) findFormStrings(paths ...interface{}) []string {
+	key, ok := finder.formKey(paths...)
+	if !ok {
+		return nil
+	}
+	var values []string
+	separator := finder.config.listSeparator()
+	for _, value := range finder.formValues(key) {
+		if separator == "" {
+			values = append(values, value)
+		} else {
+			values = append(values, strings.Split(value, separator)...)
+		}
+	}
+	if strings.Join(values, "") == "" {
+		return nil
+	}
+	return values
+}
+
+//Get all the form values of the key, from the source if it is set.
+func (finder Finder) formValues(key string) []string {
+	if finder.source != nil {
+		return finder.source(key)
 	}
-	return ""
+	finder.req.FormValue(key)
+	return finder.req.Form[key]
 }
@@ -1,9 +1,15 @@
 package jas
 
 import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -147,3 +153,447 @@ func TestFinderOptionalString(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal("May", s, "Should ignore default if string found.")
 }
+
+type ValidateRes struct{}
+
+func (*ValidateRes) Post(ctx *Context) {
+	v := ctx.Validate()
+	name := v.RequireString("name")
+	age := v.RequirePositiveInt("age")
+	password := v.RequireStringLen(6, 60, "password")
+	v.Check()
+	ctx.Data = []interface{}{name, age, password}
+}
+
+func TestValidator(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(ValidateRes))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewPostFormRequest("", "validate_res", "age", -1, "password", "123"))
+	assert.Equal(400, recorder.Code)
+	assert.Equal(`{"data":null,"error":{"code":"nameInvalid","message":"nameInvalid","field":"name","details":[`+
+		`{"code":"nameInvalid","message":"nameInvalid","field":"name"},`+
+		`{"code":"ageNotPositive","message":"ageNotPositive","field":"age"},`+
+		`{"code":"passwordTooShort","message":"passwordTooShort","field":"password"}]}}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewPostFormRequest("", "validate_res", "name", "bob", "age", 20, "password", "123456"))
+	assert.Equal(`{"data":["bob",20,"123456"],"error":null}`, recorder.Body.String())
+}
+
+func requestErrorOf(f func()) (msg string) {
+	defer func() {
+		if requestError, ok := recover().(RequestError); ok {
+			msg = requestError.Msg
+		}
+	}()
+	f()
+	return
+}
+
+func TestFinderPath(t *testing.T) {
+	assert := NewAssert(t)
+	f := FinderWithBytes([]byte(`{"photo":[{"name":"abc"},{"id":200}],"a/b":{"c~d":1},"1":{"x.y":true}}`))
+	assert.Equal("abc", f.Pointer("/photo/0/name").RequireString())
+	assert.Equal(200, f.Dotted("photo[1].id").RequireInt())
+	assert.Equal(1, f.Pointer("/a~1b/c~0d").RequireInt())
+	assert.Equal(true, f.Dotted(`1["x.y"]`).value)
+	assert.Equal("photo[0].nameInvalid", requestErrorOf(func() { f.RequireInt("photo", 0, "name") }))
+	assert.Equal("photo[1].nameInvalid", requestErrorOf(func() { f.Pointer("/photo/1/name").RequireString() }))
+	assert.Equal("photo[1].idInvalid", requestErrorOf(func() { f.Pointer("/photo").RequireString(1, "id") }))
+	assert.Equal(IndexOutOfBoundError, f.Pointer("/photo/01").err)
+	assert.Equal(MalformedPathError, f.Pointer("photo").err)
+	assert.Equal(MalformedPathError, f.Pointer("/a~2").err)
+
+	for _, path := range []string{"photo[0].name", `photo["file.name"][2]`, `[""].a`} {
+		paths, err := ParseDottedPath(path)
+		assert.Nil(err)
+		assert.Equal(path, FormatPath(paths...))
+	}
+	for _, path := range []string{".a", "a.", "a..b", "a[x]", "a[0", "a[0]b", `a["b]`} {
+		_, err := ParseDottedPath(path)
+		assert.Equal(MalformedPathError, err, path)
+	}
+}
+
+func TestFinderTypes(t *testing.T) {
+	assert := NewAssert(t)
+	f := FinderWithBytes([]byte(`{"t":"2006-01-02T15:04:05Z","ts":1136214245,"d":"1h30m","ds":1.5,"u":12,"n":-1,
+		"s":"red","id":"F47AC10B-58CC-4372-A567-0E02B2C3D479","email":"gopher@example.com","url":"https://example.com/a"}`))
+	t1, err := f.FindTime("t")
+	assert.Nil(err)
+	assert.True(t1.Equal(f.RequireTime("ts")))
+	assert.Equal(90*time.Minute, f.RequireDuration("d"))
+	assert.Equal(1500*time.Millisecond, f.RequireDuration("ds"))
+	assert.Equal(uint64(12), f.RequireUint("u"))
+	_, err = f.FindUint("n")
+	assert.NotNil(err)
+	assert.Equal(int64(12), f.RequireIntRange(1, 12, "u"))
+	_, err = f.FindIntRange(0, 10, "u")
+	assert.Equal(OutOfRangeError, err)
+	assert.Equal("uOutOfRange", requestErrorOf(func() { f.RequireIntRange(0, 10, "u") }))
+	assert.Equal("red", f.RequireEnum([]string{"red", "green"}, "s"))
+	assert.Equal("sInvalid", requestErrorOf(func() { f.RequireEnum([]string{"blue"}, "s") }))
+	assert.Equal("f47ac10b-58cc-4372-a567-0e02b2c3d479", f.RequireUUID("id"))
+	assert.Equal("sInvalid", requestErrorOf(func() { f.RequireUUID("s") }))
+	assert.Equal("gopher@example.com", f.RequireEmail("email"))
+	assert.Equal("urlInvalid", requestErrorOf(func() { f.RequireEmail("url") }))
+	assert.Equal("example.com", f.RequireURL("url").Host)
+	assert.Equal("emailInvalid", requestErrorOf(func() { f.RequireURL("email") }))
+
+	req := NewGetRequest("", "/test_finder", "ts", "1136214245", "d", "90")
+	f = FinderWithRequest(req)
+	assert.True(t1.Equal(f.RequireTime("ts")))
+	assert.Equal(90*time.Second, f.RequireDuration("d"))
+}
+
+func TestFinderList(t *testing.T) {
+	assert := NewAssert(t)
+	req := NewGetRequest("", "/test_finder?tag=a&tag=b&ids=1,2,3&bad=1,x")
+	f := FinderWithRequest(req)
+	assert.Equal([]string{"a", "b"}, f.RequireStrings("tag"))
+	assert.Equal([]string{"1,2,3"}, f.RequireStrings("ids"))
+	f.config = &Config{ListSeparator: ","}
+	assert.Equal([]int64{1, 2, 3}, f.RequireInts("ids"))
+	assert.Equal("bad[1]Invalid", requestErrorOf(func() { f.RequireInts("bad") }))
+	_, err := f.FindInts("none")
+	assert.Equal(NullValueError, err)
+
+	f = FinderWithBytes([]byte(`{"tags":["a","b"],"ids":[1,2,"3"]}`))
+	assert.Equal([]string{"a", "b"}, f.RequireStrings("tags"))
+	_, err = f.FindInts("ids")
+	assert.Equal(WrongTypeError, err)
+	assert.Equal("ids[2]Invalid", requestErrorOf(func() { f.RequireInts("ids") }))
+}
+
+type SourceRes struct{}
+
+func (*SourceRes) Gap() string {
+	return ":team"
+}
+
+func (*SourceRes) PostMembersId(ctx *Context) {
+	query, _ := ctx.QueryFinder().FindString("name")
+	body, _ := ctx.BodyFinder().FindString("name")
+	header, _ := ctx.HeaderFinder().FindString("x-name")
+	cookie, _ := ctx.CookieFinder().FindString("name")
+	ctx.Data = []interface{}{ctx.RequireString("name"), query, body, header, cookie,
+		ctx.PathFinder().RequireString("team"), ctx.PathFinder().RequireInt("id")}
+}
+
+func TestFinderSource(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(SourceRes))
+	req := NewPostJsonRequest("", "/source_res/go/members/5", []byte(`{"name":"body"}`), "name", "query")
+	req.Header.Set("X-Name", "header")
+	req.AddCookie(&http.Cookie{Name: "name", Value: "cookie"})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":["query","query","body","header","cookie","go",5],"error":null}`, recorder.Body.String())
+
+	router.BodyOverForm = true
+	req = NewPostJsonRequest("", "/source_res/go/members/5", []byte(`{"name":"body"}`), "name", "query")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":["body","query","body","","","go",5],"error":null}`, recorder.Body.String())
+
+	req = NewPostFormRequest("", "/source_res/go/members/5?name=query", "name", "form")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":["form","query","form","","","go",5],"error":null}`, recorder.Body.String())
+}
+
+type DecodeRes struct{}
+
+func (*DecodeRes) Post(ctx *Context) {
+	ctx.Data = []interface{}{ctx.RequireString("name"), ctx.RequirePositiveInt("user", "age"),
+		ctx.RequireInts("user", "ids"), ctx.RequireString("user", "tags", 1)}
+}
+
+func (*DecodeRes) PostUpload(ctx *Context) {
+	reader, err := ctx.MultipartReader()
+	if err != nil {
+		panic(err)
+	}
+	part, err := reader.NextPart()
+	if err != nil {
+		panic(err)
+	}
+	ctx.Data = part.FormName()
+}
+
+func TestBodyDecoder(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(DecodeRes))
+	req := NewPostJsonRequest("", "/decode_res", []byte(`<req><name>abc</name><user id="1"><age>20</age><ids>3</ids>`+
+		`<tags>a</tags><tags>b</tags></user></req>`))
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":["abc",20,[3],"b"],"error":null}`, recorder.Body.String())
+
+	req = NewPostFormRequest("", "/decode_res", "name", "abc", "user[age]", 20, "user[ids][]", "3",
+		"user[tags][0]", "a", "user[tags][1]", "b")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":["abc",20,[3],"b"],"error":null}`, recorder.Body.String())
+
+	req = NewPostFormRequest("", "/decode_res", "name", "abc", "user[age]", "x")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":null,"error":"user.ageInvalid"}`, recorder.Body.String())
+
+	body := bytes.NewBuffer(nil)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("name", "abc")
+	writer.Close()
+	req, _ = http.NewRequest("POST", "http://localhost/decode_res/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":"name","error":null}`, recorder.Body.String())
+
+	req, _ = http.NewRequest("POST", "http://localhost/decode_res",
+		strings.NewReader(strings.Repeat("<a>", maxXmlDepth+1)+strings.Repeat("</a>", maxXmlDepth+1)))
+	_, err := DecodeXmlBody(req)
+	assert.Equal(errXmlDepth, err)
+
+	f := FinderWithBytes([]byte(`{"age":"20"}`))
+	_, err = f.FindInt("age")
+	assert.Equal(WrongTypeError, err)
+}
+
+func TestFinderEach(t *testing.T) {
+	assert := NewAssert(t)
+	f := FinderWithBytes([]byte(`{"photo":[{"name":"abc","id":12345678901234567890},{"name":"def","id":2}],"m":{"b":1,"a":2}}`))
+	var names []string
+	err := f.Each(func(i int, photo Finder) error {
+		names = append(names, photo.RequireString("name"))
+		return nil
+	}, "photo")
+	assert.Nil(err)
+	assert.Equal([]string{"abc", "def"}, names)
+	assert.Equal("photo[0].nameInvalid", requestErrorOf(func() {
+		f.Each(func(i int, photo Finder) error {
+			photo.RequireInt("name")
+			return nil
+		}, "photo")
+	}))
+	assert.Equal(EmptyStringError, f.Each(func(i int, photo Finder) error {
+		return EmptyStringError
+	}, "photo"))
+	assert.Equal(WrongTypeError, f.Each(nil, "m"))
+
+	keys, err := f.Keys("m")
+	assert.Nil(err)
+	assert.Equal([]string{"a", "b"}, keys)
+	_, err = f.Keys("photo")
+	assert.Equal(WrongTypeError, err)
+
+	var photo struct {
+		Name string
+		Id   interface{}
+	}
+	assert.Nil(f.Decode(&photo, "photo", 0))
+	assert.Equal("abc", photo.Name)
+	assert.Equal(json.Number("12345678901234567890"), photo.Id)
+	var m map[string]int
+	assert.Nil(f.Dotted("m").Decode(&m))
+	assert.Equal(map[string]int{"a": 2, "b": 1}, m)
+	assert.Equal(EntryNotExistsError, f.Decode(&m, "none"))
+}
+
+func TestFinderNullable(t *testing.T) {
+	assert := NewAssert(t)
+	f := FinderWithBytes([]byte(`{"name":"","age":null,"tags":[null,"a"],"n":{"m":{}},"bad":"x"}`))
+	name, err := f.FindNullableString("name")
+	assert.Nil(err)
+	assert.Equal(Nullable[string]{Value: "", Present: true}, name)
+	age, err := f.FindNullableInt("age")
+	assert.Nil(err)
+	assert.True(age.Present && age.Null)
+	assert.Equal(int64(18), age.Or(18))
+	missing, err := f.FindNullableInt("missing")
+	assert.Nil(err)
+	assert.True(!missing.Present)
+	missing, err = f.FindNullableInt("age", "x")
+	assert.Nil(err)
+	assert.True(!missing.Present)
+	tag := f.RequireNullableString("tags", 0)
+	assert.True(tag.Null)
+	tag = f.RequireNullableString("tags", 1)
+	assert.True(tag.Valid())
+	assert.Equal("a", tag.Value)
+	assert.True(!f.RequireNullableString("tags", 2).Present)
+	m := f.RequireNullableMap("n", "m")
+	assert.True(m.Valid())
+	_, err = f.FindNullableInt("name", "x")
+	assert.Equal(WrongTypeError, err)
+	assert.Equal("badInvalid", requestErrorOf(func() { f.RequireNullableInt("bad") }))
+
+	f = FinderWithRequest(NewGetRequest("", "/test_finder?name=&age=3"))
+	name = f.RequireNullableString("name")
+	assert.True(name.Valid())
+	assert.Equal("", name.Value)
+	assert.Equal(int64(3), f.RequireNullableInt("age").Value)
+	assert.True(!f.RequireNullableBool("none").Present)
+
+	f = FinderWithBytes([]byte(`{"id":null,"big":123456789012345678901,"price":"12.30","kind":"a","email":null,"url":"x"}`))
+	assert.Equal("bigOutOfRange", requestErrorOf(func() { f.RequireNullableInt("big") }))
+	assert.Equal("bigOutOfRange", requestErrorOf(func() { f.RequireNullableUint("big") }))
+	assert.Equal("123456789012345678901", f.RequireNullableBigInt("big").Value.String())
+	assert.Equal("12.30", f.RequireNullableDecimal("price").Value)
+	assert.Equal("a", f.RequireNullableEnum([]string{"a", "b"}, "kind").Value)
+	assert.True(f.RequireNullableUUID("id").Null)
+	assert.True(f.RequireNullableEmail("email").Null)
+	assert.True(!f.RequireNullableBigFloat("none").Present)
+	assert.Equal("urlInvalid", requestErrorOf(func() { f.RequireNullableURL("url") }))
+}
+
+type ValidUser struct {
+	Mobile string `json:"mobile" validate:"phone"`
+	Email  string `json:"email" validate:"email"`
+	Backup string `json:"backup" validate:"omitempty,email"`
+	Tags   []struct {
+		Slug string `validate:"slug"`
+	} `json:"tags"`
+}
+
+func TestValidatorRegistry(t *testing.T) {
+	assert := NewAssert(t)
+	phoneRegexp := regexp.MustCompile(`^\+?[0-9]{6,15}$`)
+	RegisterValidator("phone", func(value interface{}) error {
+		if s, _ := value.(string); !phoneRegexp.MatchString(s) {
+			return ValidationCode("%vInvalidPhone")
+		}
+		return nil
+	})
+	RegisterValidator("slug", func(value interface{}) error {
+		if s, _ := value.(string); s == "" || strings.ToLower(s) != s {
+			return ValidationCode("InvalidSlug")
+		}
+		return nil
+	})
+	f := FinderWithBytes([]byte(`{"user":{"mobile":"123","email":"a@b.c","tags":[{"Slug":"go"},{"Slug":"Go"}]},"n":5}`))
+	assert.Equal("user.mobileInvalidPhone", requestErrorOf(func() { f.RequireValid("phone", "user", "mobile") }))
+	_, err := f.FindValid("phone", "user", "mobile")
+	assert.Equal(ValidationCode("%vInvalidPhone"), err)
+	assert.Equal("a@b.c", f.RequireValid("email", "user", "email"))
+
+	f.config = &Config{}
+	f.config.RegisterValidator("phone", func(value interface{}) error { return nil })
+	assert.Equal("123", f.RequireValid("phone", "user", "mobile"))
+	f.config.RegisterValidator("positive", func(value interface{}) error {
+		if n, _ := value.(json.Number).Int64(); n <= 0 {
+			return NotPositiveError
+		}
+		return nil
+	})
+	assert.Equal(json.Number("5"), f.RequireValid("positive", "n"))
+
+	var user ValidUser
+	defer func() {
+		validationError := recover().(*ValidationError)
+		assert.Equal(422, validationError.Status())
+		assert.Equal([]ErrorBody{{Code: "InvalidSlug", Message: "InvalidSlug", Field: "user.tags[1].Slug"}}, validationError.Errors)
+		assert.Equal("123", user.Mobile)
+		user.Mobile = "+8613800000000"
+		user.Email = "x"
+		assert.Equal([]ErrorBody{{Code: "emailInvalid", Message: "emailInvalid", Field: "email"},
+			{Code: "InvalidSlug", Message: "InvalidSlug", Field: "tags[1].Slug"}}, ValidateStruct(&user))
+		user.Backup = "y"
+		assert.Equal(3, len(ValidateStruct(&user)))
+	}()
+	f.RequireStruct(&user, "user")
+}
+
+func TestFinderBigNumber(t *testing.T) {
+	assert := NewAssert(t)
+	f := FinderWithBytes([]byte(`{"id":18446744073709551615,"big":18446744073709551616,"neg":-1,` +
+		`"amount":12.30,"s":"0.10","e":1e400,"f":1.5}`))
+	assert.Equal(uint64(18446744073709551615), f.RequireUint("id"))
+	_, err := f.FindUint("big")
+	assert.Equal(OutOfRangeError, err)
+	assert.Equal("bigOutOfRange", requestErrorOf(func() { f.RequireUint("big") }))
+	assert.Equal("negOutOfRange", requestErrorOf(func() { f.RequireUint("neg") }))
+	assert.Equal("idOutOfRange", requestErrorOf(func() { f.RequireInt("id") }))
+	assert.Equal("eOutOfRange", requestErrorOf(func() { f.RequireFloat("e") }))
+	assert.Equal("18446744073709551616", f.RequireBigInt("big").String())
+	assert.Equal("fInvalid", requestErrorOf(func() { f.RequireBigInt("f") }))
+	assert.Equal("1e+400", f.RequireBigFloat("e").Text('g', 10))
+	assert.Equal("12.30", f.RequireDecimal("amount"))
+	assert.Equal("0.10", f.RequireDecimal("s"))
+	assert.Equal("eInvalid", requestErrorOf(func() { f.RequireDecimal("e") }))
+	_, err = f.FindUint("s")
+	assert.Equal(WrongTypeError, err)
+	_, err = f.FindBigInt("s")
+	assert.Equal(WrongTypeError, err)
+	_, err = f.FindBigFloat("s")
+	assert.Equal(WrongTypeError, err)
+	long := FinderWithBytes([]byte(`{"n":` + strings.Repeat("9", MaxBigNumberLength+1) + `}`))
+	assert.Equal("nOutOfRange", requestErrorOf(func() { long.RequireBigInt("n") }))
+	assert.Equal("nOutOfRange", requestErrorOf(func() { long.RequireBigFloat("n") }))
+	assert.Equal("nOutOfRange", requestErrorOf(func() { long.RequireUint("n") }))
+
+	f = FinderWithRequest(NewGetRequest("", "/test_finder", "id", "99999999999999999999", "ids", "1,99999999999999999999"))
+	f.config = &Config{ListSeparator: ","}
+	assert.Equal("idOutOfRange", requestErrorOf(func() { f.RequireInt("id") }))
+	assert.Equal("99999999999999999999", f.RequireBigInt("id").String())
+	assert.Equal("ids[1]OutOfRange", requestErrorOf(func() { f.RequireInts("ids") }))
+}
+
+type StreamRes struct{}
+
+func (*StreamRes) StreamingBodies() []string {
+	return []string{"PostImport"}
+}
+
+func (*StreamRes) PostImport(ctx *Context) {
+	var names []string
+	err := ctx.StreamArray("items", func(item Finder) error {
+		names = append(names, item.RequireString("name"))
+		if len(names) > 2 {
+			return TooLongError
+		}
+		return nil
+	})
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	ctx.Data = []interface{}{names, ctx.Finder.value == nil, message}
+}
+
+func (*StreamRes) PostDecoded(ctx *Context) {
+	var names []string
+	err := ctx.StreamArray("", func(item Finder) error {
+		names = append(names, item.RequireString("name"))
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	ctx.Data = names
+}
+
+func TestStreamArray(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(StreamRes))
+	post := func(path, body string) string {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, NewPostJsonRequest("", path, []byte(body)))
+		return recorder.Body.String()
+	}
+	assert.Equal(`{"data":[["a","b"],true,""],"error":null}`,
+		post("/stream_res/import", `{"skip":{"x":[1,{"y":2}]},"n":1,"items":[{"name":"a"},{"name":"b"}],"after":1}`))
+	assert.Equal(`{"data":[["a","b","c"],true,"jas.Finder: string too long"],"error":null}`,
+		post("/stream_res/import", `{"items":[{"name":"a"},{"name":"b"},{"name":"c"},{"name":"d"}]}`))
+	assert.Equal(`{"data":null,"error":"items[1].nameInvalid"}`, post("/stream_res/import", `{"items":[{"name":"a"},{"id":1}]}`))
+	assert.Equal(`{"data":[null,true,"itemsInvalid"],"error":null}`, post("/stream_res/import", `{"other":[]}`))
+	assert.Equal(`{"data":[["a"],true,"MalformedJsonBody"],"error":null}`, post("/stream_res/import", `{"items":[{"name":"a"},`))
+	assert.Equal(`{"data":[null,true,"itemsInvalid"],"error":null}`, post("/stream_res/import", `[]`))
+	assert.Equal(`{"data":null,"error":"[1].nameInvalid"}`, post("/stream_res/decoded", `[{"name":"a"},{"name":1}]`))
+	assert.Equal(`{"data":["a","b"],"error":null}`, post("/stream_res/decoded", `[{"name":"a"},{"name":"b"}]`))
+	assert.Equal(`{"data":null,"error":"valueInvalid"}`, post("/stream_res/decoded", `{"name":"a"}`))
+	assert.Equal(`{"data":[null,true,"MissingJsonBody"],"error":null}`, post("/stream_res/import", ``))
+}
@@ -0,0 +1,124 @@
+package jas
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//MessageCatalog provides localized error messages, it is set by Config option `MessageCatalog`.
+type MessageCatalog interface {
+
+	//Get the message of the code in the locale, the locale is a language tag like "zh-CN" or "zh".
+	//Return false if the message is not found.
+	Message(code, locale string) (string, bool)
+}
+
+//MapCatalog is a MessageCatalog backed by a map from locale to code to message.
+//
+//	jas.MapCatalog{
+//		"zh": {"Not Found": "未找到", "%vInvalid": "%v无效", "passwordTooShort": "密码太短"},
+//	}
+//
+//Codes made by Finder like "nameInvalid" fall back to their format "%vInvalid" which is formatted with the field name.
+type MapCatalog map[string]map[string]string
+
+func (mc MapCatalog) Message(code, locale string) (string, bool) {
+	message, ok := mc[locale][code]
+	return message, ok
+}
+
+//Get the locales accepted by the client from "Accept-Language" header, ordered by preference.
+func AcceptLanguages(header http.Header) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, value := range header.Values("Accept-Language") {
+		for _, part := range strings.Split(value, ",") {
+			fields := strings.Split(part, ";")
+			tag := strings.TrimSpace(fields[0])
+			if tag == "" || tag == "*" {
+				continue
+			}
+			q := 1.0
+			for _, param := range fields[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					q, _ = strconv.ParseFloat(param[2:], 64)
+				}
+			}
+			if q > 0 {
+				tags = append(tags, weighted{tag, q})
+			}
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	locales := make([]string, len(tags))
+	for i, t := range tags {
+		locales[i] = t.tag
+	}
+	return locales
+}
+
+//Get the localized message of the code in the locales accepted by the client.
+//Return the code itself if Config option `MessageCatalog` is not set or the message is not found.
+func (ctx *Context) Localize(code string) string {
+	if message, ok := ctx.localize(code); ok {
+		return message
+	}
+	return code
+}
+
+func (ctx *Context) localize(code string) (string, bool) {
+	if ctx.config == nil || ctx.config.MessageCatalog == nil || ctx.Request == nil {
+		return "", false
+	}
+	if ctx.locales == nil {
+		ctx.locales = AcceptLanguages(ctx.Header)
+	}
+	return localize(ctx.config, ctx.locales, code)
+}
+
+func localize(config *Config, locales []string, code string) (string, bool) {
+	catalog := config.MessageCatalog
+	for _, locale := range locales {
+		for {
+			if message, ok := catalog.Message(code, locale); ok {
+				return message, true
+			}
+			if message, ok := localizeFormat(config, code, locale); ok {
+				return message, true
+			}
+			i := strings.LastIndex(locale, "-")
+			if i < 0 {
+				break
+			}
+			locale = locale[:i]
+		}
+	}
+	return "", false
+}
+
+//Localize the error codes made by Finder with its format, e.g. "nameInvalid" with "%vInvalid".
+func localizeFormat(config *Config, code, locale string) (string, bool) {
+	for _, format := range config.finderErrorFormats() {
+		i := strings.Index(format, "%v")
+		if i < 0 {
+			continue
+		}
+		prefix, suffix := format[:i], format[i+2:]
+		if len(code) <= len(prefix)+len(suffix) || !strings.HasPrefix(code, prefix) || !strings.HasSuffix(code, suffix) {
+			continue
+		}
+		if message, ok := config.MessageCatalog.Message(format, locale); ok {
+			return fmt.Sprintf(message, code[len(prefix):len(code)-len(suffix)]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,213 @@
+package jas
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+//LogRecord contains all the information of a single log entry.
+//It is passed to LogFormatter functions and emitted as attributes of structured log records.
+type LogRecord struct {
+	Time       time.Time
+	RemoteAddr string
+	UserId     int64
+	Method     string
+	Route      string //The matched route template, e.g. "/users/:id/photo".
+	URI        string
+	Proto      string
+	Status     int
+	Written    int
+	Latency    time.Duration
+	Gzip       bool
+	Referer    string
+	UserAgent  string
+	TraceId    string
+	Err        error
+	Stack      []StackFrame
+
+	stackFormat string
+}
+
+//StackFrame is a single frame of a stack trace.
+type StackFrame struct {
+	Function string  `json:"function"`
+	File     string  `json:"file"`
+	Line     int     `json:"line"`
+	PC       uintptr `json:"pc"`
+}
+
+//LogFormatter formats a LogRecord to a single line of text.
+type LogFormatter func(*LogRecord) string
+
+//The default LogFormatter for RequestErrorLogger and InternalErrorLogger.
+//It formats the record in Common Log Format followed by the quoted error string and stack trace.
+func CommonErrorLogFormatter(record *LogRecord) string {
+	errStr := "-"
+	if record.Err != nil {
+		errStr = strings.Replace(record.Err.Error(), "\n", ";", -1)
+	}
+	return fmt.Sprintf(
+		logFormat,
+		record.RemoteAddr,
+		record.UserId,
+		record.Time.Format(timeFormat),
+		record.Method,
+		record.URI,
+		record.Proto,
+		record.Status,
+		record.Written,
+		errStr,
+		formatStack(record.stackFormat, record.Stack),
+	)
+}
+
+//Formats the record in Common Log Format.
+func CommonLogFormatter(record *LogRecord) string {
+	return fmt.Sprintf(
+		accessLogFormat,
+		record.RemoteAddr,
+		record.UserId,
+		record.Time.Format(timeFormat),
+		record.Method,
+		record.URI,
+		record.Proto,
+		record.Status,
+		record.Written,
+	)
+}
+
+//The default LogFormatter for AccessLogger.
+//It formats the record in Combined Log Format followed by the quoted route template,
+//the latency in microseconds and the gzip state.
+//Most Combined Log Format parsers ignore the trailing fields.
+func CombinedLogFormatter(record *LogRecord) string {
+	route := record.Route
+	if route == "" {
+		route = "-"
+	}
+	return fmt.Sprintf(
+		combinedLogFormat,
+		CommonLogFormatter(record),
+		record.Referer,
+		record.UserAgent,
+		route,
+		record.Latency.Microseconds(),
+		record.Gzip,
+	)
+}
+
+func formatStack(format string, stack []StackFrame) string {
+	if len(stack) == 0 {
+		return "-"
+	}
+	if format == "" {
+		format = StackFormat
+	}
+	buf := new(bytes.Buffer)
+	for _, frame := range stack {
+		fmt.Fprintf(buf, format, frame.File, frame.Line, frame.PC)
+	}
+	return buf.String()
+}
+
+func newLogRecord(ctx *Context, err error, stack []StackFrame) *LogRecord {
+	record := new(LogRecord)
+	record.Time = time.Now()
+	record.RemoteAddr = ctx.ClientIP()
+	record.UserId = ctx.UserId
+	record.Method = ctx.Method
+	record.Route = ctx.route
+	record.URI = ctx.RequestURI
+	if record.URI == "" && ctx.URL != nil {
+		record.URI = ctx.URL.RequestURI()
+	}
+	record.Proto = ctx.Proto
+	record.Status = ctx.Status
+	record.Written = ctx.written
+	if !ctx.startTime.IsZero() {
+		record.Latency = record.Time.Sub(ctx.startTime)
+	}
+	if ctx.ResponseHeader != nil {
+		record.Gzip = ctx.ResponseHeader.Get("Content-Encoding") == "gzip"
+	}
+	record.Referer = ctx.Referer()
+	record.UserAgent = ctx.UserAgent()
+	record.TraceId = ctx.Trace.TraceId
+	record.Err = err
+	record.Stack = stack
+	record.stackFormat = ctx.config.stackFormat()
+	return record
+}
+
+//Log the record to the structured logger if it's set, otherwise format the record and write it to the logger.
+func doLog(logger *log.Logger, level slog.Level, ctx *Context, err error, stack []StackFrame) {
+	if ctx.config.Logger != nil {
+		logStructured(ctx.config.Logger, level, newLogRecord(ctx, err, stack))
+		return
+	}
+	if logger == nil {
+		return
+	}
+	formatter := ctx.config.ErrorLogFormatter
+	if formatter == nil {
+		formatter = CommonErrorLogFormatter
+	}
+	logger.Print(formatter(newLogRecord(ctx, err, stack)))
+}
+
+func logAccess(ctx *Context) {
+	config := ctx.config
+	if config.AccessLogger == nil && config.StructuredAccessLogger == nil {
+		return
+	}
+	var err error
+	if ctx.Error != nil {
+		err = ctx.Error
+	}
+	record := newLogRecord(ctx, err, nil)
+	if config.StructuredAccessLogger != nil {
+		logStructured(config.StructuredAccessLogger, slog.LevelInfo, record)
+	}
+	if config.AccessLogger != nil {
+		formatter := config.AccessLogFormatter
+		if formatter == nil {
+			formatter = CombinedLogFormatter
+		}
+		config.AccessLogger.Print(formatter(record))
+	}
+}
+
+func logStructured(logger *slog.Logger, level slog.Level, record *LogRecord) {
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("remote_addr", record.RemoteAddr),
+		slog.Int64("user_id", record.UserId),
+		slog.String("method", record.Method),
+		slog.String("route", record.Route),
+		slog.String("uri", record.URI),
+		slog.String("proto", record.Proto),
+		slog.Int("status", record.Status),
+		slog.Int("bytes", record.Written),
+		slog.Duration("latency", record.Latency),
+		slog.Bool("gzip", record.Gzip),
+	}
+	if record.TraceId != "" {
+		attrs = append(attrs, slog.String("trace_id", record.TraceId))
+	}
+	msg := "request"
+	if record.Err != nil {
+		msg = record.Err.Error()
+		attrs = append(attrs, slog.String("error", msg))
+	}
+	if len(record.Stack) > 0 {
+		attrs = append(attrs, slog.Any("stack", record.Stack))
+	}
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
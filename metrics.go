@@ -0,0 +1,152 @@
+package jas
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//The default latency histogram buckets in seconds.
+var DefaultMetricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//Metrics records per-route request counts, status classes and latency histograms,
+//along with the number of in-flight requests and active streaming connections.
+//Routes are labeled by their template, e.g. "/users/:id/photo", requests not handled by any resource are labeled "-".
+//It implements http.Handler to write the metrics in Prometheus text exposition format.
+type Metrics struct {
+	buckets   []float64
+	inFlight  int64
+	streaming int64
+	mu        sync.Mutex
+	routes    map[string]*routeMetrics
+}
+
+type routeMetrics struct {
+	method       string
+	route        string
+	statusCounts map[string]uint64
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+//Construct a Metrics with latency histogram buckets in seconds, DefaultMetricsBuckets is used if buckets is nil.
+func NewMetrics(buckets []float64) *Metrics {
+	if buckets == nil {
+		buckets = DefaultMetricsBuckets
+	}
+	metrics := new(Metrics)
+	metrics.buckets = append([]float64(nil), buckets...)
+	sort.Float64s(metrics.buckets)
+	metrics.routes = map[string]*routeMetrics{}
+	return metrics
+}
+
+func (m *Metrics) requestStarted() {
+	atomic.AddInt64(&m.inFlight, 1)
+}
+
+func (m *Metrics) streamingStarted() {
+	atomic.AddInt64(&m.streaming, 1)
+}
+
+func (m *Metrics) requestFinished(ctx *Context) {
+	atomic.AddInt64(&m.inFlight, -1)
+	if ctx.streaming {
+		atomic.AddInt64(&m.streaming, -1)
+	}
+	route := ctx.route
+	if route == "" {
+		route = "-"
+	}
+	method := routeMethod(ctx.Method)
+	status := strconv.Itoa(ctx.Status/100) + "xx"
+	latency := time.Since(ctx.startTime).Seconds()
+	key := method + " " + route
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rm := m.routes[key]
+	if rm == nil {
+		rm = &routeMetrics{method: method, route: route, statusCounts: map[string]uint64{}}
+		rm.bucketCounts = make([]uint64, len(m.buckets))
+		m.routes[key] = rm
+	}
+	rm.statusCounts[status]++
+	rm.count++
+	rm.sum += latency
+	for i, bound := range m.buckets {
+		if latency <= bound {
+			rm.bucketCounts[i]++
+		}
+	}
+}
+
+//Write the metrics in Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.Bytes())
+}
+
+//Get the metrics in Prometheus text exposition format.
+func (m *Metrics) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.routes))
+	for key := range m.routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf.WriteString("# HELP jas_requests_total Total number of requests by route and status class.\n")
+	buf.WriteString("# TYPE jas_requests_total counter\n")
+	for _, key := range keys {
+		rm := m.routes[key]
+		statuses := make([]string, 0, len(rm.statusCounts))
+		for status := range rm.statusCounts {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(buf, "jas_requests_total{%s,status=\"%s\"} %d\n", rm.labels(), status, rm.statusCounts[status])
+		}
+	}
+	buf.WriteString("# HELP jas_request_duration_seconds Request latency in seconds by route.\n")
+	buf.WriteString("# TYPE jas_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		rm := m.routes[key]
+		labels := rm.labels()
+		for i, bound := range m.buckets {
+			fmt.Fprintf(buf, "jas_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound), rm.bucketCounts[i])
+		}
+		fmt.Fprintf(buf, "jas_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, rm.count)
+		fmt.Fprintf(buf, "jas_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(rm.sum))
+		fmt.Fprintf(buf, "jas_request_duration_seconds_count{%s} %d\n", labels, rm.count)
+	}
+	m.mu.Unlock()
+	buf.WriteString("# HELP jas_requests_in_flight Number of requests being served.\n")
+	buf.WriteString("# TYPE jas_requests_in_flight gauge\n")
+	fmt.Fprintf(buf, "jas_requests_in_flight %d\n", atomic.LoadInt64(&m.inFlight))
+	buf.WriteString("# HELP jas_streaming_connections Number of active streaming connections.\n")
+	buf.WriteString("# TYPE jas_streaming_connections gauge\n")
+	fmt.Fprintf(buf, "jas_streaming_connections %d\n", atomic.LoadInt64(&m.streaming))
+	return buf.Bytes()
+}
+
+func (rm *routeMetrics) labels() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\"", escapeLabel(rm.method), escapeLabel(rm.route))
+}
+
+var labelReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,267 @@
+package jas
+
+import (
+	"math/big"
+	"net/url"
+	"time"
+)
+
+//Nullable is the result of FindNullable methods that tells an absent entry from a null value,
+//it is needed to implement PATCH where absent means "keep the field" and null means "clear the field".
+//
+//	name, _ := ctx.FindNullableString("name")
+//	switch {
+//	case !name.Present: // keep the name
+//	case name.Null:     // clear the name
+//	default:            // set the name to name.Value, it may be empty string
+//	}
+type Nullable[T any] struct {
+	Value   T
+	Present bool //The entry exists, its value may be null.
+	Null    bool //The value is json null, form values are never null.
+}
+
+//The value is present and not null.
+func (n Nullable[T]) Valid() bool {
+	return n.Present && !n.Null
+}
+
+//Get the value if it is present and not null, otherwise the default value.
+func (n Nullable[T]) Or(defaultValue T) T {
+	if n.Valid() {
+		return n.Value
+	}
+	return defaultValue
+}
+
+//Look up the entry, then get the value with the find function if it is present and not null.
+//The error is only returned for invalid values, not for absent entries or null values.
+func findNullable[T any](finder Finder, paths []interface{}, find func(paths ...interface{}) (T, error)) (Nullable[T], error) {
+	var n Nullable[T]
+	var err error
+	n.Present, n.Null, err = finder.presence(paths...)
+	if err == nil && n.Valid() {
+		n.Value, err = find(paths...)
+	}
+	return n, err
+}
+
+func requireNullable[T any](finder Finder, paths []interface{}, n Nullable[T], err error) Nullable[T] {
+	if err != nil {
+		finder.doPanic(requireFormat(err), paths...)
+	}
+	return n
+}
+
+//Tell whether the entry exists in form or json body and whether its value is null.
+//WrongTypeError is returned if a parent of the entry is not an object or array.
+func (finder Finder) presence(paths ...interface{}) (present, null bool, err error) {
+	if key, ok := finder.formKey(paths...); ok && len(finder.formValues(key)) > 0 {
+		return true, false, nil
+	}
+	if len(paths) == 0 {
+		return finder.value != nil, false, nil
+	}
+	parent := finder.FindChild(paths[:len(paths)-1]...)
+	if parent.err == EntryNotExistsError || parent.err == IndexOutOfBoundError || parent.err == NullValueError {
+		return false, false, nil
+	}
+	if parent.err != nil {
+		return false, false, parent.err
+	}
+	var value interface{}
+	switch last := paths[len(paths)-1].(type) {
+	case string:
+		m, ok := parent.value.(map[string]interface{})
+		if !ok {
+			return false, false, WrongTypeError
+		}
+		value, present = m[last]
+	case int:
+		slice, ok := parent.value.([]interface{})
+		if !ok {
+			return false, false, WrongTypeError
+		}
+		if last >= 0 && last < len(slice) {
+			value, present = slice[last], true
+		}
+	default:
+		panic("path type can only be string or int")
+	}
+	return present, present && value == nil, nil
+}
+
+//Get the string, empty string is a valid value.
+func (finder Finder) findStringOrEmpty(paths ...interface{}) (string, error) {
+	if key, ok := finder.formKey(paths...); ok {
+		if values := finder.formValues(key); len(values) > 0 {
+			return values[0], nil
+		}
+	}
+	s, err := finder.FindString(paths...)
+	if err == EmptyStringError {
+		err = nil
+	}
+	return s, err
+}
+
+//Empty string is a valid value, unlike FindString.
+func (finder Finder) FindNullableString(paths ...interface{}) (Nullable[string], error) {
+	return findNullable(finder, paths, finder.findStringOrEmpty)
+}
+
+func (finder Finder) RequireNullableString(paths ...interface{}) Nullable[string] {
+	n, err := finder.FindNullableString(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableInt(paths ...interface{}) (Nullable[int64], error) {
+	return findNullable(finder, paths, finder.FindInt)
+}
+
+func (finder Finder) RequireNullableInt(paths ...interface{}) Nullable[int64] {
+	n, err := finder.FindNullableInt(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableUint(paths ...interface{}) (Nullable[uint64], error) {
+	return findNullable(finder, paths, finder.FindUint)
+}
+
+func (finder Finder) RequireNullableUint(paths ...interface{}) Nullable[uint64] {
+	n, err := finder.FindNullableUint(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableBigInt(paths ...interface{}) (Nullable[*big.Int], error) {
+	return findNullable(finder, paths, finder.FindBigInt)
+}
+
+func (finder Finder) RequireNullableBigInt(paths ...interface{}) Nullable[*big.Int] {
+	n, err := finder.FindNullableBigInt(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableFloat(paths ...interface{}) (Nullable[float64], error) {
+	return findNullable(finder, paths, finder.FindFloat)
+}
+
+func (finder Finder) RequireNullableFloat(paths ...interface{}) Nullable[float64] {
+	n, err := finder.FindNullableFloat(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableBigFloat(paths ...interface{}) (Nullable[*big.Float], error) {
+	return findNullable(finder, paths, finder.FindBigFloat)
+}
+
+func (finder Finder) RequireNullableBigFloat(paths ...interface{}) Nullable[*big.Float] {
+	n, err := finder.FindNullableBigFloat(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableDecimal(paths ...interface{}) (Nullable[string], error) {
+	return findNullable(finder, paths, finder.FindDecimal)
+}
+
+func (finder Finder) RequireNullableDecimal(paths ...interface{}) Nullable[string] {
+	n, err := finder.FindNullableDecimal(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableBool(paths ...interface{}) (Nullable[bool], error) {
+	return findNullable(finder, paths, finder.FindBool)
+}
+
+func (finder Finder) RequireNullableBool(paths ...interface{}) Nullable[bool] {
+	n, err := finder.FindNullableBool(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableTime(paths ...interface{}) (Nullable[time.Time], error) {
+	return findNullable(finder, paths, finder.FindTime)
+}
+
+func (finder Finder) RequireNullableTime(paths ...interface{}) Nullable[time.Time] {
+	n, err := finder.FindNullableTime(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableDuration(paths ...interface{}) (Nullable[time.Duration], error) {
+	return findNullable(finder, paths, finder.FindDuration)
+}
+
+func (finder Finder) RequireNullableDuration(paths ...interface{}) Nullable[time.Duration] {
+	n, err := finder.FindNullableDuration(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableEnum(allowed []string, paths ...interface{}) (Nullable[string], error) {
+	return findNullable(finder, paths, func(paths ...interface{}) (string, error) {
+		return finder.FindEnum(allowed, paths...)
+	})
+}
+
+func (finder Finder) RequireNullableEnum(allowed []string, paths ...interface{}) Nullable[string] {
+	n, err := finder.FindNullableEnum(allowed, paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableUUID(paths ...interface{}) (Nullable[string], error) {
+	return findNullable(finder, paths, finder.FindUUID)
+}
+
+func (finder Finder) RequireNullableUUID(paths ...interface{}) Nullable[string] {
+	n, err := finder.FindNullableUUID(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableEmail(paths ...interface{}) (Nullable[string], error) {
+	return findNullable(finder, paths, finder.FindEmail)
+}
+
+func (finder Finder) RequireNullableEmail(paths ...interface{}) Nullable[string] {
+	n, err := finder.FindNullableEmail(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+func (finder Finder) FindNullableURL(paths ...interface{}) (Nullable[*url.URL], error) {
+	return findNullable(finder, paths, finder.FindURL)
+}
+
+func (finder Finder) RequireNullableURL(paths ...interface{}) Nullable[*url.URL] {
+	n, err := finder.FindNullableURL(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+//Empty slice is a valid value, unlike FindSlice.
+func (finder Finder) FindNullableSlice(paths ...interface{}) (Nullable[[]interface{}], error) {
+	return findNullable(finder, paths, func(paths ...interface{}) ([]interface{}, error) {
+		s, err := finder.FindSlice(paths...)
+		if err == EmptySliceError {
+			err = nil
+		}
+		return s, err
+	})
+}
+
+func (finder Finder) RequireNullableSlice(paths ...interface{}) Nullable[[]interface{}] {
+	n, err := finder.FindNullableSlice(paths...)
+	return requireNullable(finder, paths, n, err)
+}
+
+//Empty map is a valid value, unlike FindMap.
+func (finder Finder) FindNullableMap(paths ...interface{}) (Nullable[map[string]interface{}], error) {
+	return findNullable(finder, paths, func(paths ...interface{}) (map[string]interface{}, error) {
+		m, err := finder.FindMap(paths...)
+		if err == EmptyMapError {
+			err = nil
+		}
+		return m, err
+	})
+}
+
+func (finder Finder) RequireNullableMap(paths ...interface{}) Nullable[map[string]interface{}] {
+	n, err := finder.FindNullableMap(paths...)
+	return requireNullable(finder, paths, n, err)
+}
@@ -0,0 +1,139 @@
+package jas
+
+import (
+	"errors"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+var decimalRegexp = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+var negativeIntRegexp = regexp.MustCompile(`^-\d+$`)
+
+//The max length of the numbers got by FindBigInt and FindBigFloat, longer numbers are out of range.
+//It bounds the time to parse the numbers sent by clients.
+var MaxBigNumberLength = 1000
+
+//Convert the range error of strconv to OutOfRangeError, so the error made by Require methods is "%vOutOfRange".
+func numberError(err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return OutOfRangeError
+	}
+	return err
+}
+
+//Get the format kind of the error made by Require methods.
+func requireFormat(err error) int {
+	if err == OutOfRangeError {
+		return outOfRangeFormat
+	}
+	return invalidFormat
+}
+
+//Get the form string or the number as string, json strings are WrongTypeError like FindInt.
+func (finder Finder) findNumberText(paths ...interface{}) (string, error) {
+	if s := finder.findFormString(paths...); s != "" {
+		return s, nil
+	}
+	num, err := finder.findNumber(paths...)
+	return num.String(), err
+}
+
+//Get the unsigned integer, negative integers and integers greater than math.MaxUint64 are out of range.
+//Json strings are WrongTypeError like FindInt.
+func (finder Finder) FindUint(paths ...interface{}) (uint64, error) {
+	s, err := finder.findNumberText(paths...)
+	if err != nil {
+		return 0, err
+	}
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil && negativeIntRegexp.MatchString(s) {
+		return 0, OutOfRangeError
+	}
+	return u, numberError(err)
+}
+
+func (finder Finder) RequireUint(paths ...interface{}) uint64 {
+	u, err := finder.FindUint(paths...)
+	if err != nil {
+		finder.doPanic(requireFormat(err), paths...)
+	}
+	return u
+}
+
+//Get the integer of arbitrary precision, numbers with fraction or exponent are invalid.
+func (finder Finder) FindBigInt(paths ...interface{}) (*big.Int, error) {
+	s, err := finder.findNumberText(paths...)
+	if err != nil {
+		return nil, err
+	}
+	if len(s) > MaxBigNumberLength {
+		return nil, OutOfRangeError
+	}
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, WrongTypeError
+	}
+	return i, nil
+}
+
+func (finder Finder) RequireBigInt(paths ...interface{}) *big.Int {
+	i, err := finder.FindBigInt(paths...)
+	if err != nil {
+		finder.doPanic(requireFormat(err), paths...)
+	}
+	return i
+}
+
+//Get the float with enough precision to hold all the digits of the number.
+func (finder Finder) FindBigFloat(paths ...interface{}) (*big.Float, error) {
+	s, err := finder.findNumberText(paths...)
+	if err != nil {
+		return nil, err
+	}
+	if !textNumberRegexp.MatchString(s) {
+		return nil, WrongTypeError
+	}
+	if len(s) > MaxBigNumberLength {
+		return nil, OutOfRangeError
+	}
+	prec := uint(len(s)) * 4
+	if prec < 64 {
+		prec = 64
+	}
+	f, _, err := big.ParseFloat(s, 10, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, OutOfRangeError
+	}
+	return f, nil
+}
+
+func (finder Finder) RequireBigFloat(paths ...interface{}) *big.Float {
+	f, err := finder.FindBigFloat(paths...)
+	if err != nil {
+		finder.doPanic(requireFormat(err), paths...)
+	}
+	return f
+}
+
+//Get the decimal number like "12.30" as it is, without any loss of precision or trailing zeros,
+//e.g. for monetary amounts. Both json number and json string are accepted, exponent is invalid.
+func (finder Finder) FindDecimal(paths ...interface{}) (string, error) {
+	s, err := finder.findText(paths...)
+	if err != nil {
+		return "", err
+	}
+	if !decimalRegexp.MatchString(s) {
+		return "", WrongTypeError
+	}
+	return s, nil
+}
+
+func (finder Finder) RequireDecimal(paths ...interface{}) string {
+	s, err := finder.FindDecimal(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	return s
+}
@@ -0,0 +1,414 @@
+package jas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"reflect"
+	"strconv"
+)
+
+var ConflictStatusCode = 409
+
+var UnprocessableEntityStatusCode = 422
+
+var UnsupportedMediaTypeStatusCode = 415
+
+//The messages of the errors returned by ApplyMergePatch and ApplyJsonPatch.
+const (
+	MalformedPatch       = "MalformedPatch"       //The body is not a valid patch document, status 400.
+	PatchConflict        = "PatchConflict"        //The path of an operation does not exist, status 409.
+	PatchTestFailed      = "PatchTestFailed"      //A "test" operation failed, status 409.
+	UnprocessablePatch   = "UnprocessablePatch"   //The patched document does not fit the target, status 422.
+	UnsupportedMediaType = "UnsupportedMediaType" //The content type is not a patch type, status 415.
+)
+
+var errPatchMalformed = errors.New(MalformedPatch)
+var errPatchConflict = errors.New(PatchConflict)
+var errPatchTestFailed = errors.New(PatchTestFailed)
+
+//Apply the JSON Merge Patch (RFC 7396) in the request body to the target, which is a pointer to a struct or generic value.
+//The content type should be "application/merge-patch+json" or "application/json".
+//The target is not modified if an AppError is returned.
+//
+//	func (*Users) PatchId(ctx *jas.Context) {
+//		user := loadUser(ctx.Id)
+//		if err := ctx.ApplyMergePatch(&user); err != nil {
+//			ctx.Error = err
+//			return
+//		}
+//		saveUser(user)
+//	}
+func (ctx *Context) ApplyMergePatch(target interface{}) AppError {
+	patch, appErr := ctx.patchDocument("application/merge-patch+json")
+	if appErr != nil {
+		return appErr
+	}
+	doc, err := toDocument(target)
+	if err != nil {
+		return patchError(UnprocessablePatch, UnprocessableEntityStatusCode)
+	}
+	return setDocument(target, mergePatch(doc, patch))
+}
+
+//Apply the JSON Patch (RFC 6902) in the request body to the target, which is a pointer to a struct or generic value.
+//The content type should be "application/json-patch+json" or "application/json".
+//All the operations are applied or none, the target is not modified if an AppError is returned.
+func (ctx *Context) ApplyJsonPatch(target interface{}) AppError {
+	patch, appErr := ctx.patchDocument("application/json-patch+json")
+	if appErr != nil {
+		return appErr
+	}
+	operations, ok := patch.([]interface{})
+	if !ok {
+		return patchError(MalformedPatch, ctx.config.requestErrorStatusCode())
+	}
+	doc, err := toDocument(target)
+	if err != nil {
+		return patchError(UnprocessablePatch, UnprocessableEntityStatusCode)
+	}
+	for _, operation := range operations {
+		doc, err = applyOperation(doc, operation)
+		switch err {
+		case nil:
+		case errPatchMalformed:
+			return patchError(MalformedPatch, ctx.config.requestErrorStatusCode())
+		default:
+			return patchError(err.Error(), ConflictStatusCode)
+		}
+	}
+	return setDocument(target, doc)
+}
+
+//Get the decoded patch document in the request body.
+func (ctx *Context) patchDocument(patchType string) (interface{}, AppError) {
+	mediaType, _, _ := mime.ParseMediaType(ctx.Header.Get("Content-Type"))
+	if mediaType != patchType && mediaType != "application/json" {
+		return nil, patchError(UnsupportedMediaType, UnsupportedMediaTypeStatusCode)
+	}
+	if ctx.ContentLength == 0 {
+		return nil, patchError(MalformedPatch, ctx.config.requestErrorStatusCode())
+	}
+	ctx.UnmarshalInFinder()
+	if ctx.Finder.value == nil && ctx.Finder.err == nil && ctx.ContentLength < 0 {
+		ctx.Finder.value, ctx.Finder.err = DecodeJsonBody(ctx.Request)
+	}
+	if ctx.Finder.err != nil {
+		return nil, patchError(MalformedPatch, ctx.config.requestErrorStatusCode())
+	}
+	return copyDocument(ctx.Finder.value), nil
+}
+
+func patchError(message string, statusCode int) AppError {
+	return RequestError{message, statusCode}
+}
+
+//Convert the target to generic value by json round trip.
+func toDocument(target interface{}) (interface{}, error) {
+	data, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&doc)
+	return doc, err
+}
+
+//Reset the target and decode the patched document into it.
+func setDocument(target interface{}, doc interface{}) AppError {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return patchError(UnprocessablePatch, UnprocessableEntityStatusCode)
+	}
+	value := reflect.New(reflect.TypeOf(target).Elem())
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if decoder.Decode(value.Interface()) != nil {
+		return patchError(UnprocessablePatch, UnprocessableEntityStatusCode)
+	}
+	reflect.ValueOf(target).Elem().Set(value.Elem())
+	return nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetMap, ok := target.(map[string]interface{})
+	if !ok {
+		targetMap = map[string]interface{}{}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(targetMap, key)
+		} else {
+			targetMap[key] = mergePatch(targetMap[key], value)
+		}
+	}
+	return targetMap
+}
+
+func applyOperation(doc interface{}, operation interface{}) (interface{}, error) {
+	op, ok := operation.(map[string]interface{})
+	if !ok {
+		return nil, errPatchMalformed
+	}
+	name, _ := op["op"].(string)
+	path, err := operationPointer(op, "path")
+	if err != nil {
+		return nil, err
+	}
+	value, hasValue := op["value"]
+	switch name {
+	case "add", "replace", "test":
+		if !hasValue {
+			return nil, errPatchMalformed
+		}
+	case "move", "copy":
+		from, err := operationPointer(op, "from")
+		if err != nil {
+			return nil, err
+		}
+		if name == "move" && isProperPrefix(from, path) {
+			return nil, errPatchMalformed
+		}
+		if value, err = getDocument(doc, from); err != nil {
+			return nil, err
+		}
+		if name == "move" {
+			if doc, err = removeDocument(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = copyDocument(value)
+		}
+	case "remove":
+	default:
+		return nil, errPatchMalformed
+	}
+	switch name {
+	case "add", "move", "copy":
+		return addDocument(doc, path, value)
+	case "remove":
+		return removeDocument(doc, path)
+	case "replace":
+		if _, err := getDocument(doc, path); err != nil || len(path) == 0 {
+			return value, err
+		}
+		if doc, err = removeDocument(doc, path); err != nil {
+			return nil, err
+		}
+		return addDocument(doc, path, value)
+	}
+	actual, err := getDocument(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	if !jsonEqual(actual, value) {
+		return nil, errPatchTestFailed
+	}
+	return doc, nil
+}
+
+func operationPointer(op map[string]interface{}, key string) ([]string, error) {
+	pointer, ok := op[key].(string)
+	if !ok {
+		return nil, errPatchMalformed
+	}
+	tokens, err := ParseJsonPointer(pointer)
+	if err != nil {
+		return nil, errPatchMalformed
+	}
+	return tokens, nil
+}
+
+func isProperPrefix(prefix, tokens []string) bool {
+	if len(prefix) >= len(tokens) {
+		return false
+	}
+	for i, token := range prefix {
+		if tokens[i] != token {
+			return false
+		}
+	}
+	return true
+}
+
+//Parse the array index token, "-" is the index after the last element which is only valid for "add".
+func arrayIndex(token string, length int) (int, bool) {
+	if token == "-" {
+		return length, true
+	}
+	if len(token) > 1 && token[0] == '0' {
+		return 0, false
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || (len(token) > 0 && token[0] == '+') {
+		return 0, false
+	}
+	return index, true
+}
+
+func getDocument(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, errPatchConflict
+			}
+			doc = value
+		case []interface{}:
+			index, ok := arrayIndex(token, len(node))
+			if !ok || index == len(node) {
+				return nil, errPatchConflict
+			}
+			doc = node[index]
+		default:
+			return nil, errPatchConflict
+		}
+	}
+	return doc, nil
+}
+
+//Call the function with the parent of the location and the last token, replace the parent with the returned value.
+func updateParent(doc interface{}, tokens []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, errPatchConflict
+		}
+		child, err := updateParent(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = child
+		return node, nil
+	case []interface{}:
+		index, ok := arrayIndex(tokens[0], len(node))
+		if !ok || index == len(node) {
+			return nil, errPatchConflict
+		}
+		child, err := updateParent(node[index], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	}
+	return nil, errPatchConflict
+}
+
+func addDocument(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			index, ok := arrayIndex(token, len(node))
+			if !ok {
+				return nil, errPatchConflict
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		return nil, errPatchConflict
+	})
+}
+
+func removeDocument(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errPatchConflict
+	}
+	return updateParent(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, errPatchConflict
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			index, ok := arrayIndex(token, len(node))
+			if !ok || index == len(node) {
+				return nil, errPatchConflict
+			}
+			return append(node[:index], node[index+1:]...), nil
+		}
+		return nil, errPatchConflict
+	})
+}
+
+func copyDocument(doc interface{}) interface{} {
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for key, value := range node {
+			m[key] = copyDocument(value)
+		}
+		return m
+	case []interface{}:
+		slice := make([]interface{}, len(node))
+		for i, value := range node {
+			slice[i] = copyDocument(value)
+		}
+		return slice
+	}
+	return doc
+}
+
+//Compare the json values, numbers are equal if their values are equal, like 1 and 1.0.
+func jsonEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,167 @@
+package jas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var MalformedPathError = errors.New("jas.Finder: malformed path")
+
+//Get the child Finder at the RFC 6901 JSON Pointer, e.g. "/photo/0/name".
+//A reference token is used as array index if the value is an array, otherwise as object key.
+//Only the json body is looked up, form values are not.
+//Errors of Require methods called on the child Finder contain the full path, e.g. "photo[0].nameInvalid".
+func (finder Finder) Pointer(pointer string) Finder {
+	tokens, err := ParseJsonPointer(pointer)
+	if err != nil {
+		finder.req, finder.source = nil, nil
+		finder.err = err
+		return finder
+	}
+	for _, token := range tokens {
+		if _, ok := finder.value.([]interface{}); ok {
+			index, err := strconv.Atoi(token)
+			if err != nil || (len(token) > 1 && token[0] == '0') {
+				finder.req, finder.source = nil, nil
+				finder.path = appendPath(finder.path, token)
+				finder.err = IndexOutOfBoundError
+				return finder
+			}
+			finder = finder.FindChild(index)
+		} else {
+			finder = finder.FindChild(token)
+		}
+		if finder.err != nil {
+			return finder
+		}
+	}
+	finder.req, finder.source = nil, nil
+	return finder
+}
+
+//Get the child Finder at the dotted path, e.g. "photo[0].name", see ParseDottedPath.
+//Only the json body is looked up, form values are not.
+//Errors of Require methods called on the child Finder contain the full path, e.g. "photo[0].nameInvalid".
+func (finder Finder) Dotted(path string) Finder {
+	paths, err := ParseDottedPath(path)
+	if err != nil {
+		finder.req, finder.source = nil, nil
+		finder.err = err
+		return finder
+	}
+	return finder.FindChild(paths...)
+}
+
+//Parse the RFC 6901 JSON Pointer to unescaped reference tokens, e.g. "/a~1b/0" to ["a/b", "0"].
+//The empty string refers to the whole document.
+func ParseJsonPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, MalformedPathError
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, MalformedPathError
+			}
+		}
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+//Parse the dotted path to the paths accepted by Finder methods, e.g. "photo[0].name" to ["photo", 0, "name"].
+//Keys that contain special characters can be quoted in brackets, e.g. `photo["file.name"]`.
+func ParseDottedPath(path string) ([]interface{}, error) {
+	var paths []interface{}
+	i := 0
+	for i < len(path) {
+		switch path[i] {
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, MalformedPathError
+			}
+			if i+1 < len(path) && path[i+1] == '"' {
+				var key string
+				decoder := json.NewDecoder(strings.NewReader(path[i+1:]))
+				if decoder.Decode(&key) != nil {
+					return nil, MalformedPathError
+				}
+				end = i + 1 + int(decoder.InputOffset())
+				if end >= len(path) || path[end] != ']' {
+					return nil, MalformedPathError
+				}
+				paths = append(paths, key)
+			} else {
+				end += i
+				index, err := strconv.Atoi(path[i+1 : end])
+				if err != nil || index < 0 {
+					return nil, MalformedPathError
+				}
+				paths = append(paths, index)
+			}
+			i = end + 1
+		case '.':
+			if i == 0 || i+1 == len(path) {
+				return nil, MalformedPathError
+			}
+			i++
+			fallthrough
+		default:
+			if len(paths) > 0 && path[i-1] != '.' {
+				return nil, MalformedPathError
+			}
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path)
+			} else {
+				end += i
+			}
+			if end == i {
+				return nil, MalformedPathError
+			}
+			paths = append(paths, path[i:end])
+			i = end
+		}
+	}
+	return paths, nil
+}
+
+//Format the paths to dotted path, e.g. ["photo", 0, "name"] to "photo[0].name".
+//It is the reverse of ParseDottedPath.
+func FormatPath(paths ...interface{}) string {
+	buf := new(bytes.Buffer)
+	for i, path := range paths {
+		switch p := path.(type) {
+		case int:
+			buf.WriteString("[" + strconv.Itoa(p) + "]")
+		case string:
+			if p == "" || strings.ContainsAny(p, ".[]\"") {
+				quoted, _ := json.Marshal(p)
+				buf.WriteString("[" + string(quoted) + "]")
+			} else {
+				if i > 0 {
+					buf.WriteByte('.')
+				}
+				buf.WriteString(p)
+			}
+		}
+	}
+	return buf.String()
+}
+
+func appendPath(base []interface{}, paths ...interface{}) []interface{} {
+	if len(paths) == 0 {
+		return base
+	}
+	fullPath := make([]interface{}, 0, len(base)+len(paths))
+	fullPath = append(fullPath, base...)
+	return append(fullPath, paths...)
+}
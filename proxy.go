@@ -0,0 +1,163 @@
+package jas
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+//Get the ip address of the client.
+//If the request comes from a proxy in Config option `TrustedProxies`, the header of Config option `ForwardedHeader`
+//is walked from right to left, the first address that is not a trusted proxy is the client address.
+//The walk stops at the first node that is not an ip address like "unknown" or empty, then the last trusted proxy
+//is the client address. Otherwise it is the host of RemoteAddr.
+func (ctx *Context) ClientIP() string {
+	if ctx.clientIP != "" {
+		return ctx.clientIP
+	}
+	ctx.clientIP = remoteHost(ctx.RemoteAddr)
+	if !ctx.fromTrustedProxy() {
+		return ctx.clientIP
+	}
+	addrs, _ := ctx.forwardedAddrs()
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(addrs[i])
+		if err != nil {
+			break
+		}
+		ctx.clientIP = addr.Unmap().String()
+		if !ctx.isTrustedProxy(ctx.clientIP) {
+			break
+		}
+	}
+	return ctx.clientIP
+}
+
+//Get the scheme of the original request, "http" or "https".
+//It is obtained from the "Forwarded" or "X-Forwarded-Proto" header by Config option `ForwardedHeader`
+//if the request comes from a trusted proxy.
+func (ctx *Context) OriginalScheme() string {
+	if ctx.fromTrustedProxy() {
+		if proto := ctx.forwardedParam("proto", "X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(proto)
+		}
+	}
+	if ctx.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+//Get the host of the original request.
+//It is obtained from the "Forwarded" or "X-Forwarded-Host" header by Config option `ForwardedHeader`
+//if the request comes from a trusted proxy.
+func (ctx *Context) OriginalHost() string {
+	if ctx.fromTrustedProxy() {
+		if host := ctx.forwardedParam("host", "X-Forwarded-Host"); host != "" {
+			return host
+		}
+	}
+	return ctx.Host
+}
+
+//Build an absolute url of the path with the original scheme and host, e.g. "https://example.com/v1/users".
+func (ctx *Context) AbsoluteUrl(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return ctx.OriginalScheme() + "://" + ctx.OriginalHost() + path
+}
+
+func (ctx *Context) fromTrustedProxy() bool {
+	return ctx.isTrustedProxy(remoteHost(ctx.RemoteAddr))
+}
+
+func (ctx *Context) isTrustedProxy(ip string) bool {
+	if ctx.config == nil || len(ctx.config.TrustedProxies) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range ctx.config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+//Get the forwarded client addresses from the header of Config option `ForwardedHeader`.
+//The parameters of each "Forwarded" element are returned along with the addresses.
+func (ctx *Context) forwardedAddrs() (addrs []string, params []map[string]string) {
+	if ctx.config.forwardedHeader() == "Forwarded" {
+		params = []map[string]string{}
+		for _, element := range strings.Split(strings.Join(ctx.Header.Values("Forwarded"), ","), ",") {
+			pairs := parseForwardedElement(element)
+			addrs = append(addrs, forwardedNode(pairs["for"]))
+			params = append(params, pairs)
+		}
+		return
+	}
+	for _, value := range ctx.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			addrs = append(addrs, strings.TrimSpace(addr))
+		}
+	}
+	return
+}
+
+//Get the parameter of the "Forwarded" element that describes the client, or the first value of the header.
+func (ctx *Context) forwardedParam(name, header string) string {
+	addrs, params := ctx.forwardedAddrs()
+	if params != nil {
+		clientIP := ctx.ClientIP()
+		for i := len(addrs) - 1; i >= 0; i-- {
+			if addr, err := netip.ParseAddr(addrs[i]); err == nil && addr.Unmap().String() == clientIP {
+				return params[i][name]
+			}
+		}
+		return ""
+	}
+	value := ctx.Header.Get(header)
+	if i := strings.Index(value, ","); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
+
+func parseForwardedElement(element string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(element, ";") {
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(pair[:i]))
+		pairs[key] = strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+	}
+	return pairs
+}
+
+//Strip the port and brackets of a "Forwarded" node, e.g. "[2001:db8::1]:4711" to "2001:db8::1".
+func forwardedNode(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if i := strings.Index(node, "]"); i > 0 {
+			return node[1:i]
+		}
+	}
+	if strings.Count(node, ":") == 1 {
+		return node[:strings.Index(node, ":")]
+	}
+	return node
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -0,0 +1,153 @@
+package jas
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var TooManyRequestsStatusCode = 429
+
+//RateLimiter limits the request rate with token buckets.
+//Each key has its own bucket which holds at most Burst tokens and is refilled at Rate tokens per second,
+//a request takes one token, requests that find the bucket empty will be responded with 429 status code.
+//It can be set globally by Config option `RateLimiter` or per resource method by implementing ResourceWithRateLimits.
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+
+	//Get the key of the bucket from the request, e.g. RateLimitByIP, RateLimitByUserId.
+	//Return empty string to skip rate limiting for the request.
+	Key func(*Context) string
+
+	//Defaults to an in-memory store of the rate limiter, created on first use.
+	Store RateLimitStore
+
+	storeOnce sync.Once
+}
+
+//Construct a RateLimiter with the default in-memory store.
+func NewRateLimiter(rate float64, burst int, key func(*Context) string) *RateLimiter {
+	return &RateLimiter{Rate: rate, Burst: burst, Key: key}
+}
+
+//Implement this interface to rate limit resource methods.
+//The map key is the method name, e.g. "PostPhoto".
+//The method rate limiter applies in addition to Config option `RateLimiter`.
+type ResourceWithRateLimits interface {
+	RateLimits() map[string]*RateLimiter
+}
+
+//RateLimitResult is the state of a token bucket after taking a token.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration //The duration until a token is available, zero if allowed.
+	Reset      time.Duration //The duration until the bucket is full.
+}
+
+//RateLimitStore stores the token buckets, implement it to share rate limits between servers.
+type RateLimitStore interface {
+
+	//Take a token from the bucket of the key.
+	Take(key string, rate float64, burst int, now time.Time) RateLimitResult
+}
+
+//Key requests by the client ip, see *Context.ClientIP.
+func RateLimitByIP(ctx *Context) string {
+	return ctx.ClientIP()
+}
+
+//Key requests by the user id, falls back to the client ip if the user id is not available.
+func RateLimitByUserId(ctx *Context) string {
+	if ctx.UserId > 0 {
+		return "user:" + strconv.FormatInt(ctx.UserId, 10)
+	}
+	return RateLimitByIP(ctx)
+}
+
+//MemoryRateLimitStore is an in-memory RateLimitStore implementation.
+//Buckets that have been refilled to full are removed periodically.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (ms *MemoryRateLimitStore) Take(key string, rate float64, burst int, now time.Time) RateLimitResult {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if now.Sub(ms.lastSweep) > time.Minute {
+		for k, b := range ms.buckets {
+			if !now.Before(b.full) {
+				delete(ms.buckets, k)
+			}
+		}
+		ms.lastSweep = now
+	}
+	bucket := ms.buckets[key]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: float64(burst), updated: now}
+		ms.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+	var result RateLimitResult
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / rate)
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = secondsToDuration((float64(burst) - bucket.tokens) / rate)
+	bucket.full = now.Add(result.Reset)
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+//Take a token for the request, set the "RateLimit-*" response headers,
+//and panic with a RequestError of TooManyRequestsStatusCode if the bucket is empty.
+func (rl *RateLimiter) limit(ctx *Context, scope string) {
+	keyFunc := rl.Key
+	if keyFunc == nil {
+		keyFunc = RateLimitByIP
+	}
+	key := keyFunc(ctx)
+	if key == "" {
+		return
+	}
+	rl.storeOnce.Do(func() {
+		if rl.Store == nil {
+			rl.Store = NewMemoryRateLimitStore()
+		}
+	})
+	result := rl.Store.Take(scope+"|"+key, rl.Rate, rl.Burst, time.Now())
+	ctx.ResponseHeader.Set("RateLimit-Limit", strconv.Itoa(rl.Burst))
+	ctx.ResponseHeader.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	ctx.ResponseHeader.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		ctx.ResponseHeader.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		requestError := NewRequestError("TooManyRequests")
+		requestError.StatusCode = TooManyRequestsStatusCode
+		panic(requestError)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -6,19 +6,26 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var WordSeparator = "_"
 
 type Router struct {
-	methodMap map[string]func(*Context)
-	gapsMap   map[string][]string
+	methodMap  map[string]func(*Context)
+	gapsMap    map[string][]string
+	rateLimits map[string]*RateLimiter
+	schemas    map[string]*Schema
+	streaming  map[string]bool
+	handlers   map[string]http.Handler
 	*Config
 }
 
@@ -50,10 +57,74 @@ type Config struct {
 	//log to standard err by default.
 	InternalErrorLogger *log.Logger
 
+	//If set, every request will be logged to it after the response is written,
+	//including the requests handled by OnNotFound.
+	AccessLogger *log.Logger
+
+	//Formats the log line written to AccessLogger.
+	//Defaults to CombinedLogFormatter, CommonLogFormatter can be used for Common Log Format.
+	AccessLogFormatter LogFormatter
+
+	//If set, every request will be logged to it as a structured record at info level.
+	StructuredAccessLogger *slog.Logger
+
+	//If set, request counts, status classes, latencies, in-flight requests and
+	//streaming connections will be recorded to it.
+	Metrics *Metrics
+
+	//If set along with Metrics, the metrics will be served in Prometheus text format at the path.
+	//It is matched against the full url path, e.g. "/metrics".
+	MetricsPath string
+
+	//Formats the log line written to RequestErrorLogger and InternalErrorLogger.
+	//Defaults to CommonErrorLogFormatter.
+	ErrorLogFormatter LogFormatter
+
+	//If set, request errors and internal errors will be logged as structured records to it
+	//instead of RequestErrorLogger and InternalErrorLogger.
+	//Request errors are logged at warn level, internal errors are logged at error level.
+	Logger *slog.Logger
+
 	//If set, it will be called after recovered from panic.
-	//Do time consuming work in the function will not increase response time because it runs in its own goroutine.
+	//Do time consuming work in the function will not increase response time because it runs asynchronously
+	//by a bounded number of goroutines, see AsyncWorkers.
+	//The *Context is a snapshot detached from the response, it can not write data to the client.
 	OnAppError func(AppError, *Context)
 
+	//The number of goroutines that run OnAppError and asynchronous AppError.Log, defaults to 4.
+	AsyncWorkers int
+
+	//The max number of pending OnAppError and asynchronous AppError.Log calls, defaults to 1024.
+	AsyncQueueSize int
+
+	//What to do when the queue is full, defaults to DropNewest.
+	//The number of dropped errors can be obtained by *Router.DispatchStats.
+	AsyncDropPolicy DropPolicy
+
+	//If set to true, AppError.Log will be called asynchronously along with OnAppError.
+	AsyncLog bool
+
+	//If set, the W3C trace context will be parsed from the request header to *Context.Trace,
+	//and the tracer will be notified at each stage of the request.
+	//MemoryTracer can be used in tests.
+	Tracer Tracer
+
+	//The addresses of the proxies that are trusted to set the "Forwarded" and "X-Forwarded-*" headers.
+	//It is used by *Context.ClientIP, OriginalScheme and OriginalHost,
+	//e.g. []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	TrustedProxies []netip.Prefix
+
+	//The header set by the trusted proxies to get the client address, "X-Forwarded-For" or "Forwarded".
+	//Only this header is used, the other one may be set by the client and is ignored.
+	//The "X-Forwarded-Proto" and "X-Forwarded-Host" headers are used along with "X-Forwarded-For",
+	//the "proto" and "host" parameters of the client element are used along with "Forwarded".
+	//Defaults to "X-Forwarded-For".
+	ForwardedHeader string
+
+	//If set, all requests will be rate limited by it before calling the matched method.
+	//Resource methods can have their own rate limiters by implementing ResourceWithRateLimits.
+	RateLimiter *RateLimiter
+
 	//If set, it will be called before calling the matched method.
 	BeforeServe func(*Context)
 
@@ -78,44 +149,183 @@ type Config struct {
 	//it should return the number of bytes has been written.
 	HijackWrite func(io.Writer, *Context) int
 
+	//If set, error messages will be localized to the locales in the request "Accept-Language" header.
+	//The localized message is responded in the "message" field along with the "error" field,
+	//e.g. `{"data":null,"error":"nameInvalid","message":"名字无效"}`,
+	//for DetailedError the "message" field of the error object is localized.
+	MessageCatalog MessageCatalog
+
+	//If set to true, errors will be responded in RFC 7807 "application/problem+json" format
+	//instead of the `{"data":...,"error":...}` format.
+	//It does not apply to JSONP requests and requests that have already flushed data.
+	ProblemDetails bool
+
 	//If set to true, json request body will not be unmarshaled in Finder automatically.
 	//Then you will be able to call `Unmarshal` to unmarshal the body to a struct.
 	//If you still want to get body parameter with Finder methods in some cases, you can call `UnmarshalInFinder`
 	//explicitly before you get body parameters with Finder methods.
 	DisableAutoUnmarshal bool
 
+	//The decoders of request body keyed by media type, used by Finder to get body parameters.
+	//Defaults to a copy of package level variable `DefaultBodyDecoders`.
+	//Numbers and booleans are parsed from strings if the media type is not json, so xml and form bodies
+	//work with the same Finder methods as json body.
+	BodyDecoders map[string]BodyDecoder
+
+	//If set to true, json body takes precedence over form parameters in Finder methods of Context,
+	//so a query parameter can not override a json body field.
+	//Post form parameters always take precedence over query parameters.
+	BodyOverForm bool
+
+	//The separator to split form values by in FindStrings and FindInts like "," for "ids=1,2,3".
+	//Defaults to empty string that does not split, then only repeated keys like "ids=1&ids=2" are lists.
+	ListSeparator string
+
+	//The formats of the error messages made by Finder Require methods.
+	//Defaults to the package level variables with the same name.
+	InvalidErrorFormat     string
+	NotPositiveErrorFormat string
+	TooShortErrorFormat    string
+	TooLongErrorFormat     string
+	OutOfRangeErrorFormat  string
+
+	//The status codes of request error made by Finder Require methods, internal error and not found response.
+	//Defaults to the package level variables with the same name.
+	RequestErrorStatusCode  int
+	InternalErrorStatusCode int
+	NotFoundStatusCode      int
+
+	//Stack trace format of internal error log, defaults to package level variable `StackFormat`.
+	StackFormat string
+
+	//The separator of words in paths converted from resource names and method names.
+	//Defaults to package level variable `WordSeparator`.
+	//It is only used when the router is constructed, so it must be set with NewRouterWithConfig.
+	WordSeparator string
+
 	//By default gap only matches non-integer segment, set true to allow gap to match integer segment.
 	//But then resource with gap will shadow id resource.
 	//e.g "/user/123" will be resolved to "User" that has "Gap" method instead of "UserId".
 	AllowIntegerGap bool
+
+	//The validators used by RequireValid and struct tags, see *Config.RegisterValidator.
+	//Validators registered by package level function `RegisterValidator` are used if the name is not found.
+	Validators map[string]ValidatorFunc
+
+	dispatcher *asyncDispatcher
+}
+
+//Get the formats of Finder errors, indexed by the error kind.
+//The package level variables are used for zero value options or nil config.
+func (config *Config) finderErrorFormats() []string {
+	formats := []string{InvalidErrorFormat, NotPositiveErrorFormat, TooShortErrorFormat, TooLongErrorFormat, OutOfRangeErrorFormat}
+	if config != nil {
+		configFormats := []string{config.InvalidErrorFormat, config.NotPositiveErrorFormat, config.TooShortErrorFormat,
+			config.TooLongErrorFormat, config.OutOfRangeErrorFormat}
+		for i, format := range configFormats {
+			if format != "" {
+				formats[i] = format
+			}
+		}
+	}
+	return formats
+}
+
+func (config *Config) requestErrorStatusCode() int {
+	if config == nil || config.RequestErrorStatusCode == 0 {
+		return RequestErrorStatusCode
+	}
+	return config.RequestErrorStatusCode
+}
+
+func (config *Config) internalErrorStatusCode() int {
+	if config == nil || config.InternalErrorStatusCode == 0 {
+		return InternalErrorStatusCode
+	}
+	return config.InternalErrorStatusCode
+}
+
+func (config *Config) notFoundStatusCode() int {
+	if config == nil || config.NotFoundStatusCode == 0 {
+		return NotFoundStatusCode
+	}
+	return config.NotFoundStatusCode
+}
+
+func (config *Config) stackFormat() string {
+	if config == nil || config.StackFormat == "" {
+		return StackFormat
+	}
+	return config.StackFormat
+}
+
+func (config *Config) wordSeparator() string {
+	if config == nil || config.WordSeparator == "" {
+		return WordSeparator
+	}
+	return config.WordSeparator
+}
+
+func (config *Config) forwardedHeader() string {
+	if config == nil || config.ForwardedHeader == "" {
+		return "X-Forwarded-For"
+	}
+	return config.ForwardedHeader
+}
+
+func (config *Config) bodyOverForm() bool {
+	return config != nil && config.BodyOverForm
+}
+
+func (config *Config) listSeparator() string {
+	if config == nil {
+		return ""
+	}
+	return config.ListSeparator
 }
 
 //Implements http.Handler interface.
 func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	if handler, ok := router.handlers[r.URL.Path]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if router.Metrics != nil {
+		if router.MetricsPath != "" && r.URL.Path == router.MetricsPath {
+			router.Metrics.ServeHTTP(w, r)
+			return
+		}
+		router.Metrics.requestStarted()
+	}
 	if !strings.HasPrefix(r.URL.Path, router.BasePath) {
-		router.OnNotFound(w, r)
+		router.handleNotFound(w, r, startTime)
 		return
 	}
 	rawPath := r.URL.Path[len(router.BasePath):]
 	path, id, segments, gaps := router.resolvePath(r.Method, rawPath)
 	method, ok := router.methodMap[path]
 	if !ok {
-		router.OnNotFound(w, r)
+		router.handleNotFound(w, r, startTime)
 		return
 	}
 	ctx := new(Context)
+	ctx.startTime = startTime
+	ctx.route = path[strings.Index(path, " ")+1:]
 	ctx.Id = id
 	ctx.pathSegments = segments
 	ctx.Request = r
 	ctx.gaps = gaps
 	ctx.Finder = FinderWithRequest(r)
-	if !router.DisableAutoUnmarshal {
+	ctx.Finder.config = router.Config
+	if !router.DisableAutoUnmarshal && !router.streaming[path] {
 		ctx.UnmarshalInFinder()
 	}
 	ctx.ResponseHeader = w.Header()
 	ctx.config = router.Config
 	ctx.responseWriter = w
 	ctx.Status = 200
+	defer finishRequest(ctx)
 	if router.HandleCORS != nil && !router.HandleCORS(r, ctx.ResponseHeader) {
 		return
 	}
@@ -132,16 +342,81 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	ctx.ResponseHeader.Set("Cache-Control", "no-cache")
 	ctx.ResponseHeader.Set("Content-Type", "application/json; charset=utf-8")
+	if router.Tracer != nil {
+		ctx.Trace = ParseTraceContext(r.Header)
+	}
 	defer ctx.deferredResponse()
+	if router.Tracer != nil {
+		router.Tracer.StartRequest(ctx)
+	}
+	if router.RateLimiter != nil {
+		router.RateLimiter.limit(ctx, "*")
+	}
+	if rateLimiter := router.rateLimits[path]; rateLimiter != nil {
+		rateLimiter.limit(ctx, path)
+	}
 	if router.BeforeServe != nil {
 		router.BeforeServe(ctx)
 	}
+	if schema := router.schemas[path]; schema != nil && !router.streaming[path] {
+		ctx.validateSchema(schema)
+	}
 	method(ctx)
 	if router.AfterServe != nil {
 		router.AfterServe(ctx)
 	}
 }
 
+func (router *Router) handleNotFound(w http.ResponseWriter, r *http.Request, startTime time.Time) {
+	if router.AccessLogger == nil && router.StructuredAccessLogger == nil && router.Metrics == nil {
+		router.OnNotFound(w, r)
+		return
+	}
+	recorder := &responseRecorder{ResponseWriter: w, status: 200}
+	ctx := new(Context)
+	ctx.Request = r
+	ctx.ResponseHeader = w.Header()
+	ctx.config = router.Config
+	ctx.startTime = startTime
+	ctx.Status = router.internalErrorStatusCode()
+	defer finishRequest(ctx)
+	router.OnNotFound(recorder, r)
+	ctx.Status = recorder.status
+	ctx.written = recorder.written
+}
+
+//Record metrics and write access log, it is called after the response has been written, even if a panic occurred.
+func finishRequest(ctx *Context) {
+	if ctx.config.Metrics != nil {
+		ctx.config.Metrics.requestFinished(ctx)
+	}
+	logAccess(ctx)
+}
+
+//responseRecorder records the status code and the number of bytes written by a http.ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(p)
+	rr.written += n
+	return n, err
+}
+
+//Serve the handler at the path, the path is matched against the full url path, e.g. "/debug/errors".
+//It can be used to serve debug endpoints like ErrorAggregator along with the resources.
+func (router *Router) Handle(path string, handler http.Handler) {
+	router.handlers[path] = handler
+}
+
 //Get the paths that have been handled by resources.
 //The paths are sorted, it can be used to detect api path changes.
 func (r *Router) HandledPaths(withBasePath bool) string {
@@ -166,24 +441,54 @@ func (r *Router) HandledPaths(withBasePath bool) string {
 // You can make multiple routers with different base path to handle requests to the same host.
 // See documentation about resources at the top of the file.
 func NewRouter(resources ...interface{}) *Router {
-	router := new(Router)
-	router.methodMap = map[string]func(*Context){}
-	router.gapsMap = map[string][]string{}
+	return NewRouterWithConfig(NewConfig(), resources...)
+}
+
+// Construct a Config with default values.
+// The options like InvalidErrorFormat and WordSeparator are left zero, so the package level variables
+// with the same name are used, even if they are changed after the config is constructed.
+func NewConfig() *Config {
 	config := new(Config)
 	config.BasePath = "/"
 	config.InternalErrorLogger = log.New(os.Stderr, "", 0)
-	config.OnNotFound = notFound
+	config.ErrorLogFormatter = CommonErrorLogFormatter
+	config.AccessLogFormatter = CombinedLogFormatter
+	config.OnNotFound = config.notFound
+	config.BodyDecoders = make(map[string]BodyDecoder, len(DefaultBodyDecoders))
+	for mediaType, decoder := range DefaultBodyDecoders {
+		config.BodyDecoders[mediaType] = decoder
+	}
+	config.dispatcher = newAsyncDispatcher(config)
+	return config
+}
+
+// Construct a Router instance with the config.
+// It is needed if the config option `WordSeparator` is changed, because the separator is used to
+// convert resource names and method names to paths when the router is constructed.
+func NewRouterWithConfig(config *Config, resources ...interface{}) *Router {
+	router := new(Router)
+	router.methodMap = map[string]func(*Context){}
+	router.gapsMap = map[string][]string{}
+	router.rateLimits = map[string]*RateLimiter{}
+	router.schemas = map[string]*Schema{}
+	router.streaming = map[string]bool{}
+	router.handlers = map[string]http.Handler{}
 	router.Config = config
+	if config.dispatcher == nil {
+		config.dispatcher = newAsyncDispatcher(config)
+	}
+	separator := config.wordSeparator()
 	for _, v := range resources {
 		resType := reflect.TypeOf(v)
 		resValue := reflect.ValueOf(v)
 		resName := resType.Elem().Name()
-		resNameSnake := convertName(resName)
+		resNameSnake := convertName(resName, separator)
 		resNameSnakeLen := len(resNameSnake)
+		idSuffixLen := len(separator) + 2
 		var isIdResource bool
 		var gap string
-		if resNameSnakeLen > 3 && resNameSnake[resNameSnakeLen-3:] == "_id" {
-			resNameSnake = resNameSnake[:resNameSnakeLen-3]
+		if resNameSnakeLen > idSuffixLen && resNameSnake[resNameSnakeLen-idSuffixLen:] == separator+"id" {
+			resNameSnake = resNameSnake[:resNameSnakeLen-idSuffixLen]
 			resNameSnake += "/:id"
 			isIdResource = true
 		} else if resWithGap, ok := v.(ResourceWithGap); ok {
@@ -191,14 +496,28 @@ func NewRouter(resources ...interface{}) *Router {
 			router.gapsMap[resNameSnake] = strings.Split(gap, "/")
 			resNameSnake += "/" + gap
 		}
+		var rateLimits map[string]*RateLimiter
+		if resWithRateLimits, ok := v.(ResourceWithRateLimits); ok {
+			rateLimits = resWithRateLimits.RateLimits()
+		}
+		var schemas map[string]*Schema
+		if resWithSchemas, ok := v.(ResourceWithSchemas); ok {
+			schemas = resWithSchemas.Schemas()
+		}
+		streamingMethods := map[string]bool{}
+		if resWithStreamingBodies, ok := v.(ResourceWithStreamingBodies); ok {
+			for _, methodName := range resWithStreamingBodies.StreamingBodies() {
+				streamingMethods[methodName] = true
+			}
+		}
 		for i := 0; i < resType.NumMethod(); i++ {
 			methodType := resType.Method(i)
 			if !validateMethod(&methodType) {
 				continue
 			}
 			httpMethod := "GET"
-			methodName := convertName(methodType.Name)
-			methodWords := strings.Split(methodName, WordSeparator)
+			methodName := convertName(methodType.Name, separator)
+			methodWords := strings.Split(methodName, separator)
 			var hasHttpMethod bool
 			minIdMethodLen := 2
 			switch methodWords[0] {
@@ -208,12 +527,12 @@ func NewRouter(resources ...interface{}) *Router {
 			}
 			var isIdMethod bool
 			if !isIdResource && len(methodWords) >= minIdMethodLen && methodWords[len(methodWords)-1] == "id" {
-				methodName = methodName[:len(methodName)-3]
+				methodName = methodName[:len(methodName)-idSuffixLen]
 				isIdMethod = true
 			}
 			if hasHttpMethod {
 				if len(methodWords) > 1 {
-					methodName = "/" + methodName[len(methodWords[0])+1:]
+					methodName = "/" + methodName[len(methodWords[0])+len(separator):]
 				} else {
 					methodName = ""
 				}
@@ -230,6 +549,16 @@ func NewRouter(resources ...interface{}) *Router {
 			}
 			path := httpMethod + " /" + resNameSnake + methodName
 			router.methodMap[path] = methodValue.Interface().(func(*Context))
+			if rateLimiter := rateLimits[methodType.Name]; rateLimiter != nil {
+				router.rateLimits[path] = rateLimiter
+			}
+			if schema := schemas[methodType.Name]; schema != nil {
+				schema.compile()
+				router.schemas[path] = schema
+			}
+			if streamingMethods[methodType.Name] {
+				router.streaming[path] = true
+			}
 		}
 	}
 	return router
@@ -255,23 +584,26 @@ func validateMethod(method *reflect.Method) bool {
 	return true
 }
 
-func convertName(name string) string {
+func convertName(name, separator string) string {
 	buf := bytes.NewBufferString("")
 	for i, v := range name {
 		if i > 0 && v >= 'A' && v <= 'Z' {
-			buf.WriteString(WordSeparator)
+			buf.WriteString(separator)
 		}
 		buf.WriteRune(v)
 	}
 	return strings.ToLower(buf.String())
 }
 
-func notFound(w http.ResponseWriter, r *http.Request) {
+func (config *Config) notFound(w http.ResponseWriter, r *http.Request) {
 	var response Response
 	response.Error = "Not Found"
+	if config.MessageCatalog != nil {
+		response.Message, _ = localize(config, AcceptLanguages(r.Header), "Not Found")
+	}
 	jsonbytes, _ := json.Marshal(response)
 	w.Header().Set("Connection", "close")
-	w.WriteHeader(NotFoundStatusCode)
+	w.WriteHeader(config.notFoundStatusCode())
 	w.Write(jsonbytes)
 }
 
@@ -286,12 +618,7 @@ func AllowCORS(r *http.Request, responseHeader http.Header) bool {
 
 func (r *Router) resolvePath(method string, rawPath string) (path string, id int64, segments []string, gaps []string) {
 	segments = strings.Split(rawPath, "/")
-	httpMethod := "GET"
-	switch method {
-	case "POST", "DELETE", "PUT", "PATCH":
-		httpMethod = method
-	}
-	path = httpMethod + " /" + segments[0]
+	path = routeMethod(method) + " /" + segments[0]
 	seg1 := ""
 	if len(segments) >= 2 {
 		seg1 = segments[1]
@@ -321,3 +648,13 @@ func (r *Router) resolvePath(method string, rawPath string) (path string, id int
 	}
 	return
 }
+
+//Get the http method of the route that handles the request method.
+//Methods other than "POST", "DELETE", "PUT" and "PATCH" are handled by "GET" routes.
+func routeMethod(method string) string {
+	switch method {
+	case "POST", "DELETE", "PUT", "PATCH":
+		return method
+	}
+	return "GET"
+}
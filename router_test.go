@@ -3,14 +3,20 @@ package jas
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var empty = fmt.Sprint("")
@@ -184,6 +190,478 @@ func TestError(t *testing.T) {
 	assert.True(strings.Index(loggedLine, "router_test.go") != -1)
 }
 
+func TestStructuredLog(t *testing.T) {
+	assert := NewAssert(t)
+	buffer := bytes.NewBuffer(nil)
+	router := NewRouter(new(Error))
+	router.Logger = slog.New(slog.NewJSONHandler(buffer, nil))
+	req := NewGetRequest("", "error/internal")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	var record struct {
+		Level  string       `json:"level"`
+		Method string       `json:"method"`
+		Route  string       `json:"route"`
+		Status int          `json:"status"`
+		Error  string       `json:"error"`
+		Stack  []StackFrame `json:"stack"`
+	}
+	assert.MustNil(json.Unmarshal(buffer.Bytes(), &record))
+	assert.Equal("ERROR", record.Level)
+	assert.Equal("GET", record.Method)
+	assert.Equal("/error/internal", record.Route)
+	assert.Equal(500, record.Status)
+	assert.True(len(record.Stack) > 0)
+
+	buffer.Reset()
+	req = NewGetRequest("", "error/request")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.MustNil(json.Unmarshal(buffer.Bytes(), &record))
+	assert.Equal("WARN", record.Level)
+	assert.Equal("request error", record.Error)
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := NewAssert(t)
+	buffer := bytes.NewBuffer(nil)
+	router := NewRouter(new(Users))
+	router.AccessLogger = log.New(buffer, "", 0)
+	req := NewGetRequest("", "users/john/photos/5")
+	req.Header.Set("User-Agent", "tester")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	loggedLine := buffer.String()
+	assert.True(strings.Contains(loggedLine, `"GET /users/john/photos/5 HTTP/1.1" 200 23 "" "tester" "/users/:username/photos/:id"`), loggedLine)
+	assert.True(strings.HasSuffix(loggedLine, " false\n"), loggedLine)
+
+	buffer.Reset()
+	router.AccessLogFormatter = CommonLogFormatter
+	req = NewGetRequest("", "nowhere")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	loggedLine = buffer.String()
+	assert.True(strings.HasSuffix(loggedLine, `"GET /nowhere HTTP/1.1" 404 33`+"\n"), loggedLine)
+}
+
+func TestMetrics(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(Error), new(Hello))
+	router.Metrics = NewMetrics(nil)
+	router.MetricsPath = "/metrics"
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/internal"))
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "hello"))
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "hello"))
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "users/7"))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewGetRequest("", "metrics"))
+	body := recorder.Body.String()
+	assert.True(strings.Contains(body, `jas_requests_total{method="GET",route="/error/internal",status="5xx"} 1`), body)
+	assert.True(strings.Contains(body, `jas_requests_total{method="GET",route="/hello",status="2xx"} 2`), body)
+	assert.True(strings.Contains(body, `jas_requests_total{method="GET",route="-",status="4xx"} 1`), body)
+	assert.True(strings.Contains(body, `jas_request_duration_seconds_count{method="GET",route="/hello"} 2`), body)
+	assert.True(strings.Contains(body, `jas_requests_in_flight 0`), body)
+	assert.True(strings.Contains(body, `jas_streaming_connections 0`), body)
+
+	router.OnNotFound = func(w http.ResponseWriter, r *http.Request) {
+		panic("not found handler failed")
+	}
+	func() {
+		defer func() { recover() }()
+		router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "users/7"))
+	}()
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewGetRequest("", "metrics"))
+	body = recorder.Body.String()
+	assert.True(strings.Contains(body, `jas_requests_in_flight 0`), body)
+	assert.True(strings.Contains(body, `jas_requests_total{method="GET",route="-",status="5xx"} 1`), body)
+}
+
+func TestTracing(t *testing.T) {
+	assert := NewAssert(t)
+	tracer := new(MemoryTracer)
+	router := NewRouter(new(Error), new(Hello))
+	router.InternalErrorLogger = nil
+	router.Tracer = tracer
+	req := NewGetRequest("", "error/internal")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	events := tracer.Events()
+	assert.MustEqual(4, len(events))
+	assert.Equal("start", events[0].Stage)
+	assert.Equal("method", events[1].Stage)
+	assert.Equal("error", events[2].Stage)
+	assert.Equal("written", events[3].Stage)
+	assert.Equal(500, events[3].Status)
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", events[0].TraceId)
+	assert.Equal(16, len(events[0].SpanId))
+	assert.NotEqual("00f067aa0ba902b7", events[0].SpanId)
+
+	tracer.Reset()
+	req = NewGetRequest("", "hello")
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	events = tracer.Events()
+	assert.MustEqual(3, len(events))
+	assert.Equal(32, len(events[0].TraceId))
+	assert.NotEqual("00000000000000000000000000000000", events[0].TraceId)
+
+	tc := ParseTraceContext(http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}})
+	header := http.Header{}
+	tc.Inject(header)
+	assert.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-"+tc.SpanId+"-01", header.Get("traceparent"))
+	assert.Equal("00f067aa0ba902b7", tc.ParentSpanId)
+}
+
+type Limited struct{}
+
+func (*Limited) RateLimits() map[string]*RateLimiter {
+	return map[string]*RateLimiter{"Expensive": NewRateLimiter(0.001, 1, RateLimitByUserId)}
+}
+
+func (*Limited) Expensive(ctx *Context) {}
+
+func (*Limited) Cheap(ctx *Context) {}
+
+func TestRateLimit(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(Limited))
+	router.RateLimiter = NewRateLimiter(0.001, 3, nil)
+	limitedRequest := func(path string) *http.Request {
+		req := NewGetRequest("", path)
+		req.RemoteAddr = "10.0.0.1:5000"
+		return req
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, limitedRequest("limited/expensive"))
+	assert.Equal(200, recorder.Code)
+	assert.Equal("0", recorder.Header().Get("RateLimit-Remaining"))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, limitedRequest("limited/expensive"))
+	assert.Equal(429, recorder.Code)
+	assert.Equal(`{"data":null,"error":"TooManyRequests"}`, recorder.Body.String())
+	assert.Equal("1000", recorder.Header().Get("Retry-After"))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, limitedRequest("limited/cheap"))
+	assert.Equal(200, recorder.Code)
+	assert.Equal("3", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal("0", recorder.Header().Get("RateLimit-Remaining"))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, limitedRequest("limited/cheap"))
+	assert.Equal(429, recorder.Code)
+
+	otherRouter := NewRouter(new(Limited))
+	otherRouter.RateLimiter = NewRateLimiter(0.001, 5, nil)
+	recorder = httptest.NewRecorder()
+	otherRouter.ServeHTTP(recorder, limitedRequest("limited/cheap"))
+	assert.Equal(200, recorder.Code)
+	assert.Equal("4", recorder.Header().Get("RateLimit-Remaining"))
+}
+
+func TestClientIP(t *testing.T) {
+	assert := NewAssert(t)
+	config := new(Config)
+	newContext := func(remoteAddr string, header ...string) *Context {
+		ctx := new(Context)
+		ctx.Request = NewGetRequest("", "users")
+		ctx.RemoteAddr = remoteAddr
+		for i := 0; i < len(header); i += 2 {
+			ctx.Header.Add(header[i], header[i+1])
+		}
+		ctx.config = config
+		return ctx
+	}
+	ctx := newContext("10.0.0.2:3000", "X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+	assert.Equal("10.0.0.2", ctx.ClientIP())
+	assert.Equal("http://localhost/v1", ctx.AbsoluteUrl("v1"))
+
+	config.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	ctx = newContext("10.0.0.2:3000", "X-Forwarded-For", "1.1.1.1, 2.2.2.2", "X-Forwarded-For", "10.0.0.3",
+		"X-Forwarded-Proto", "https", "X-Forwarded-Host", "api.example.com")
+	assert.Equal("2.2.2.2", ctx.ClientIP())
+	assert.Equal("https://api.example.com/v1", ctx.AbsoluteUrl("/v1"))
+
+	ctx = newContext("10.0.0.2:3000", "X-Forwarded-For", "203.0.113.9", "Forwarded", "for=")
+	assert.Equal("203.0.113.9", ctx.ClientIP())
+	ctx = newContext("10.0.0.2:3000", "X-Forwarded-For", "unknown, ")
+	assert.Equal("10.0.0.2", ctx.ClientIP())
+
+	config.ForwardedHeader = "Forwarded"
+	ctx = newContext("10.0.0.2:3000", "X-Forwarded-For", "1.1.1.1", "Forwarded", "for=")
+	assert.Equal("10.0.0.2", ctx.ClientIP())
+	ctx = newContext("10.0.0.2:3000", "Forwarded", `for=unknown, for=10.0.0.3`)
+	assert.Equal("10.0.0.3", ctx.ClientIP())
+	ctx = newContext("10.0.0.2:3000", "Forwarded", `for=1.1.1.1;proto=http, for="[2001:db8::1]:4711";proto=https;host=example.com`)
+	assert.Equal("2001:db8::1", ctx.ClientIP())
+	assert.Equal("https", ctx.OriginalScheme())
+	assert.Equal("example.com", ctx.OriginalHost())
+
+	ctx = newContext("192.168.0.1:3000", "X-Forwarded-For", "1.1.1.1", "X-Forwarded-Host", "evil.com")
+	assert.Equal("192.168.0.1", ctx.ClientIP())
+	assert.Equal("localhost", ctx.OriginalHost())
+
+	router := NewRouter(new(Limited))
+	router.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	router.RateLimiter = NewRateLimiter(0.001, 1, nil)
+	for i, code := range []int{200, 429, 429} {
+		req := NewGetRequest("", "limited/cheap")
+		req.RemoteAddr = "10.0.0.2:3000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		req.Header.Set("Forwarded", "for=")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(code, recorder.Code, i)
+	}
+}
+
+func (h *Error) Detailed(ctx *Context) {
+	detailedError := NewDetailedRequestError("photoTooLarge", "photo is too large")
+	detailedError.FieldPath = "photo"
+	detailedError.Detail = map[string]int{"maxBytes": 1024}
+	panic(detailedError)
+}
+
+func TestDetailedError(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(Error))
+	router.InternalErrorLogger = nil
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewGetRequest("", "error/detailed"))
+	assert.Equal(400, recorder.Code)
+	assert.Equal(`{"data":null,"error":{"code":"photoTooLarge","message":"photo is too large","field":"photo","details":{"maxBytes":1024}}}`, recorder.Body.String())
+
+	router.ProblemDetails = true
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewGetRequest("", "error/detailed"))
+	assert.Equal("application/problem+json", recorder.Header().Get("Content-Type"))
+	assert.Equal(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"photo is too large","instance":"/error/detailed","code":"photoTooLarge","field":"photo","details":{"maxBytes":1024}}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewGetRequest("", "error/request"))
+	assert.Equal(`{"type":"about:blank","title":"Bad Request","status":400,"detail":"request error","instance":"/error/request","code":"request error"}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewGetRequest("", "error/internal"))
+	assert.Equal(`{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"InternalError","instance":"/error/internal"}`, recorder.Body.String())
+}
+
+type Localized struct{}
+
+func (*Localized) Get(ctx *Context) {
+	ctx.RequireString("name")
+}
+
+func TestLocalize(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(Localized))
+	router.MessageCatalog = MapCatalog{
+		"zh":    {"%vInvalid": "%v无效", "Not Found": "未找到"},
+		"en-GB": {"nameInvalid": "Please enter a name"},
+	}
+	req := NewGetRequest("", "localized")
+	req.Header.Set("Accept-Language", "fr;q=0.9, zh-CN;q=0.8, en")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":null,"error":"nameInvalid","message":"name无效"}`, recorder.Body.String())
+
+	req.Header.Set("Accept-Language", "en-GB, zh")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":null,"error":"nameInvalid","message":"Please enter a name"}`, recorder.Body.String())
+
+	req.Header.Set("Accept-Language", "de")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":null,"error":"nameInvalid"}`, recorder.Body.String())
+
+	req = NewGetRequest("", "nowhere")
+	req.Header.Set("Accept-Language", "zh")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(`{"data":null,"error":"Not Found","message":"未找到"}`, recorder.Body.String())
+}
+
+var sharedDetailedError = NewDetailedRequestError("shared", "shared error")
+
+type SharedError struct{}
+
+func (*SharedError) Get(ctx *Context) {
+	panic(sharedDetailedError)
+}
+
+func TestRouterConfig(t *testing.T) {
+	assert := NewAssert(t)
+	config := NewConfig()
+	config.WordSeparator = "-"
+	config.InvalidErrorFormat = "invalid_%v"
+	config.RequestErrorStatusCode = 422
+	config.NotFoundStatusCode = 410
+	partner := NewRouterWithConfig(config, new(Localized), new(UsersId))
+	public := NewRouter(new(Localized), new(UsersId))
+	assert.Equal("GET /localized\nGET /users/:id/image-url\nGET /users/:id/post\nPOST /users/:id/post", partner.HandledPaths(false))
+	assert.Equal("GET /localized\nGET /users/:id/image_url\nGET /users/:id/post\nPOST /users/:id/post", public.HandledPaths(false))
+
+	recorder := httptest.NewRecorder()
+	partner.ServeHTTP(recorder, NewGetRequest("", "localized"))
+	assert.Equal(422, recorder.Code)
+	assert.Equal(`{"data":null,"error":"invalid_name"}`, recorder.Body.String())
+	recorder = httptest.NewRecorder()
+	public.ServeHTTP(recorder, NewGetRequest("", "localized"))
+	assert.Equal(400, recorder.Code)
+	assert.Equal(`{"data":null,"error":"nameInvalid"}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	partner.ServeHTTP(recorder, NewGetRequest("", "nowhere"))
+	assert.Equal(410, recorder.Code)
+
+	errorRouter := NewRouterWithConfig(config, new(Error))
+	errorRouter.InternalErrorLogger = nil
+	recorder = httptest.NewRecorder()
+	errorRouter.ServeHTTP(recorder, NewGetRequest("", "error/detailed"))
+	assert.Equal(422, recorder.Code)
+	otherConfig := NewConfig()
+	otherConfig.RequestErrorStatusCode = 418
+	otherConfig.InternalErrorLogger = nil
+	recorder = httptest.NewRecorder()
+	NewRouterWithConfig(otherConfig, new(Error)).ServeHTTP(recorder, NewGetRequest("", "error/detailed"))
+	assert.Equal(418, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	NewRouterWithConfig(config, new(SharedError)).ServeHTTP(recorder, NewGetRequest("", "shared-error"))
+	assert.Equal(422, recorder.Code)
+	recorder = httptest.NewRecorder()
+	NewRouterWithConfig(otherConfig, new(SharedError)).ServeHTTP(recorder, NewGetRequest("", "shared_error"))
+	assert.Equal(418, recorder.Code)
+	assert.Equal(0, sharedDetailedError.StatusCode)
+}
+
+var errSentinel = errors.New("sentinel")
+
+func panicSentinel() {
+	panic(fmt.Errorf("wrapped: %w", errSentinel))
+}
+
+func recoverInternalError() (ie InternalError) {
+	defer func() {
+		ie = NewInternalError(recover())
+	}()
+	panicSentinel()
+	return
+}
+
+func TestInternalErrorStack(t *testing.T) {
+	assert := NewAssert(t)
+	ie := recoverInternalError()
+	assert.True(errors.Is(ie, errSentinel))
+	stack := ie.Stack()
+	assert.MustTrue(len(stack) > 1)
+	assert.True(strings.HasSuffix(stack[0].Function, ".panicSentinel"), stack[0].Function)
+	assert.True(strings.HasSuffix(stack[1].Function, ".recoverInternalError"), stack[1].Function)
+	assert.True(strings.HasSuffix(stack[0].File, "router_test.go"), stack[0].File)
+	assert.Equal("wrapped: sentinel", ie.Error())
+	assert.Equal(errSentinel, errors.Unwrap(ie.Err))
+	copied := ie
+	assert.True(copied == ie)
+
+	literal := InternalError{Err: errSentinel, StatusCode: 500}
+	assert.True(errors.Is(literal, errSentinel))
+	assert.Equal(0, len(literal.Stack()))
+}
+
+func TestAsyncAppError(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(Error))
+	router.AsyncWorkers = 1
+	router.AsyncQueueSize = 1
+	started := make(chan bool, 3)
+	release := make(chan bool)
+	var handled int32
+	router.OnAppError = func(appErr AppError, ctx *Context) {
+		started <- ctx.ClientClosed()
+		<-release
+		atomic.AddInt32(&handled, 1)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/request"))
+	assert.True(<-started, "snapshot should be detached from the response")
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/request"))
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/request"))
+	assert.Equal(DispatchStats{Processed: 0, Dropped: 1, Pending: 1}, router.DispatchStats())
+	close(release)
+	router.Close()
+	assert.Equal(2, atomic.LoadInt32(&handled))
+	assert.Equal(DispatchStats{Processed: 2, Dropped: 1, Pending: 0}, router.DispatchStats())
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/request"))
+	assert.Equal(2, router.DispatchStats().Dropped)
+
+	router = NewRouterWithConfig(&Config{BasePath: "/", OnAppError: func(appErr AppError, ctx *Context) {
+		atomic.AddInt32(&handled, 1)
+	}}, new(Error))
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/request"))
+	router.Close()
+	assert.Equal(3, atomic.LoadInt32(&handled))
+	assert.Equal(DispatchStats{Processed: 1}, router.DispatchStats())
+}
+
+func TestErrorAggregator(t *testing.T) {
+	assert := NewAssert(t)
+	buffer := bytes.NewBuffer(nil)
+	aggregator := NewErrorAggregator(time.Hour, log.New(buffer, "", 0))
+	router := NewRouter(new(Error))
+	router.InternalErrorLogger = nil
+	router.OnAppError = aggregator.OnAppError
+	router.Handle("/debug/errors", aggregator)
+	for i := 0; i < 3; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/internal"))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/request"))
+	router.Close()
+	aggregates := aggregator.Aggregates()
+	assert.MustEqual(1, len(aggregates))
+	assert.Equal(3, aggregates[0].Total)
+	assert.Equal("/error/internal", aggregates[0].Route)
+	assert.Equal(1, strings.Count(buffer.String(), "\n"))
+	assert.True(strings.Contains(buffer.String(), "router_test.go"))
+
+	aggregator.Flush()
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.MustEqual(2, len(lines))
+	assert.True(strings.HasPrefix(lines[1], aggregates[0].Fingerprint+" occurred 2 more times"), lines[1])
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewGetRequest("", "debug/errors"))
+	var response struct {
+		Data []ErrorAggregate
+	}
+	assert.MustNil(json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.MustEqual(1, len(response.Data))
+	assert.Equal(aggregates[0].Fingerprint, response.Data[0].Fingerprint)
+
+	buffer = bytes.NewBuffer(nil)
+	aggregator = NewErrorAggregator(10*time.Millisecond, log.New(buffer, "", 0))
+	router = NewRouter(new(Error))
+	router.InternalErrorLogger = nil
+	router.OnAppError = aggregator.OnAppError
+	for i := 0; i < 3; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), NewGetRequest("", "error/internal"))
+	}
+	router.Close()
+	time.Sleep(50 * time.Millisecond)
+	aggregates = aggregator.Aggregates()
+	lines = strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.MustEqual(2, len(lines))
+	assert.True(strings.HasPrefix(lines[1], aggregates[0].Fingerprint+" occurred 2 more times"), lines[1])
+
+	aggregator = NewErrorAggregator(time.Hour, nil)
+	ctx := new(Context)
+	aggregator.OnAppError(InternalError{Err: errors.New("a"), StatusCode: 500}, ctx)
+	aggregator.OnAppError(InternalError{Err: errors.New("b"), StatusCode: 500}, ctx)
+	aggregator.OnAppError(InternalError{Err: errors.New("a"), StatusCode: 500}, ctx)
+	aggregates = aggregator.Aggregates()
+	assert.MustEqual(2, len(aggregates))
+	assert.Equal("a", aggregates[0].Error)
+	assert.Equal(2, aggregates[0].Total)
+	aggregator.Flush()
+}
+
 type Jsonp struct {
 }
 
@@ -258,3 +736,173 @@ func handleHello(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Write(jsonBytes)
 }
+
+type PatchDoc struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age,omitempty"`
+	Tags []string `json:"tags"`
+}
+
+func (*PatchDoc) PatchMerge(ctx *Context) {
+	doc := PatchDoc{"abc", 20, []string{"a"}}
+	if ctx.Error = ctx.ApplyMergePatch(&doc); ctx.Error == nil {
+		ctx.Data = doc
+	}
+}
+
+func (*PatchDoc) PatchJson(ctx *Context) {
+	doc := PatchDoc{"abc", 20, []string{"a"}}
+	if ctx.Error = ctx.ApplyJsonPatch(&doc); ctx.Error == nil {
+		ctx.Data = doc
+	}
+}
+
+func (*PatchDoc) PatchGeneric(ctx *Context) {
+	doc := map[string]interface{}{}
+	if ctx.Error = ctx.ApplyJsonPatch(&doc); ctx.Error == nil {
+		ctx.Data = []interface{}{doc, ctx.RequireMap(0, "value")}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(PatchDoc))
+	patch := func(path, contentType, body string) (int, string) {
+		req, _ := http.NewRequest("PATCH", "http://localhost/patch_doc/"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code, recorder.Body.String()
+	}
+	code, body := patch("merge", "application/merge-patch+json", `{"name":"def","age":null,"tags":["b","c"]}`)
+	assert.Equal(200, code)
+	assert.Equal(`{"data":{"name":"def","tags":["b","c"]},"error":null}`, body)
+	code, _ = patch("merge", "text/plain", `{"name":"def"}`)
+	assert.Equal(415, code)
+	code, body = patch("merge", "application/merge-patch+json", `{"name":1}`)
+	assert.Equal(422, code)
+	assert.Equal(`{"data":null,"error":"UnprocessablePatch"}`, body)
+	code, _ = patch("merge", "application/merge-patch+json", `{"name":`)
+	assert.Equal(400, code)
+
+	code, body = patch("json", "application/json-patch+json", `[{"op":"test","path":"/age","value":20.0},`+
+		`{"op":"add","path":"/tags/0","value":"z"},{"op":"copy","from":"/name","path":"/tags/-"},`+
+		`{"op":"move","from":"/tags/1","path":"/name"},{"op":"remove","path":"/age"},{"op":"replace","path":"/tags/0","value":"y"}]`)
+	assert.Equal(200, code)
+	assert.Equal(`{"data":{"name":"a","tags":["y","abc"]},"error":null}`, body)
+	code, body = patch("json", "application/json-patch+json", `[{"op":"test","path":"/name","value":"x"}]`)
+	assert.Equal(409, code)
+	assert.Equal(`{"data":null,"error":"PatchTestFailed"}`, body)
+	code, body = patch("json", "application/json-patch+json", `[{"op":"remove","path":"/tags/5"}]`)
+	assert.Equal(409, code)
+	assert.Equal(`{"data":null,"error":"PatchConflict"}`, body)
+	code, _ = patch("json", "application/json-patch+json", `[{"op":"add","path":"/name"}]`)
+	assert.Equal(400, code)
+	code, _ = patch("json", "application/json-patch+json", `{"op":"add"}`)
+	assert.Equal(400, code)
+	code, _ = patch("json", "application/json-patch+json", `[{"op":"add","path":"/unknown","value":1}]`)
+	assert.Equal(422, code)
+	code, body = patch("generic", "application/json-patch+json",
+		`[{"op":"add","path":"/obj","value":{"a":1}},{"op":"add","path":"/obj/b","value":2}]`)
+	assert.Equal(200, code)
+	assert.Equal(`{"data":[{"obj":{"a":1,"b":2}},{"a":1}],"error":null}`, body)
+
+	config := NewConfig()
+	config.RequestErrorStatusCode = 418
+	router = NewRouterWithConfig(config, new(PatchDoc))
+	code, _ = patch("json", "application/json-patch+json", `{"op":"add"}`)
+	assert.Equal(418, code)
+}
+
+type SchemaRes struct{}
+
+func (*SchemaRes) Schemas() map[string]*Schema {
+	return map[string]*Schema{
+		"Post": {
+			Type:     "object",
+			Required: []string{"name", "age"},
+			Properties: map[string]*Schema{
+				"name":  {Type: "string", MinLength: IntPtr(2), Pattern: "^[a-z]+$"},
+				"age":   {Type: "integer", Minimum: FloatPtr(0), Maximum: FloatPtr(150)},
+				"color": {Enum: []interface{}{"red", 1}},
+				"photos": {Type: "array", MaxItems: IntPtr(2), Items: &Schema{
+					Type: "object", Required: []string{"id"}, Properties: map[string]*Schema{"id": {Type: "integer"}},
+				}},
+			},
+		},
+	}
+}
+
+func (*SchemaRes) Post(ctx *Context) {
+	ctx.Data = ctx.RequireString("name")
+}
+
+type UnmarshalSchemaRes struct{}
+
+func (*UnmarshalSchemaRes) Schemas() map[string]*Schema {
+	return map[string]*Schema{"Post": {Type: "object", Required: []string{"name"}}}
+}
+
+func (*UnmarshalSchemaRes) Post(ctx *Context) {
+	var user struct {
+		Name string `json:"name"`
+	}
+	if err := ctx.Unmarshal(&user); err != nil {
+		panic(err)
+	}
+	ctx.Data = user.Name
+}
+
+func TestSchema(t *testing.T) {
+	assert := NewAssert(t)
+	router := NewRouter(new(SchemaRes))
+	post := func(body string) (int, string) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, NewPostJsonRequest("", "/schema_res", []byte(body)))
+		return recorder.Code, recorder.Body.String()
+	}
+	code, body := post(`{"name":"abc","age":20.0,"color":1,"photos":[{"id":1}]}`)
+	assert.Equal(200, code)
+	assert.Equal(`{"data":"abc","error":null}`, body)
+	code, body = post(`{"name":"A","age":200,"color":"blue","photos":[{"id":"x"},{}]}`)
+	assert.Equal(422, code)
+	assert.Equal(`{"data":null,"error":{"code":"ageOutOfRange","message":"ageOutOfRange","field":"age","details":[`+
+		`{"code":"ageOutOfRange","message":"ageOutOfRange","field":"age"},`+
+		`{"code":"colorInvalid","message":"colorInvalid","field":"color"},`+
+		`{"code":"nameTooShort","message":"nameTooShort","field":"name"},`+
+		`{"code":"nameInvalid","message":"nameInvalid","field":"name"},`+
+		`{"code":"photos[0].idInvalid","message":"photos[0].idInvalid","field":"photos[0].id"},`+
+		`{"code":"photos[1].idInvalid","message":"photos[1].idInvalid","field":"photos[1].id"}]}}`, body)
+	code, _ = post(`[]`)
+	assert.Equal(422, code)
+	code, body = post(`{"name":`)
+	assert.Equal(400, code)
+	assert.Equal(`{"data":null,"error":"MalformedJsonBody"}`, body)
+	code, body = post(``)
+	assert.Equal(400, code)
+	assert.Equal(`{"data":null,"error":"MissingJsonBody"}`, body)
+
+	chunked := NewPostJsonRequest("", "/schema_res", nil)
+	chunked.Body = io.NopCloser(strings.NewReader(`{"name":"abc","age":20}`))
+	chunked.ContentLength = -1
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, chunked)
+	assert.Equal(`{"data":"abc","error":null}`, recorder.Body.String())
+
+	req := NewPostFormRequest("", "/schema_res", "name", "abc", "age", "20")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(200, recorder.Code)
+
+	schemas := router.RouteSchemas()
+	assert.Equal(1, len(schemas))
+	jsonBytes, _ := json.Marshal(schemas["POST /schema_res"].Properties["age"])
+	assert.Equal(`{"type":"integer","minimum":0,"maximum":150}`, string(jsonBytes))
+
+	config := NewConfig()
+	config.DisableAutoUnmarshal = true
+	router = NewRouterWithConfig(config, new(UnmarshalSchemaRes))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, NewPostJsonRequest("", "/unmarshal_schema_res", []byte(`{"name":"abc"}`)))
+	assert.Equal(`{"data":"abc","error":null}`, recorder.Body.String())
+}
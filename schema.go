@@ -0,0 +1,268 @@
+package jas
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+//Schema is a subset of JSON Schema draft 2020-12 to validate request body before the resource method runs.
+//It is marshaled to JSON Schema, so it can be used to generate api documents, see *Router.RouteSchemas.
+//
+//	&jas.Schema{
+//		Type:     "object",
+//		Required: []string{"name"},
+//		Properties: map[string]*jas.Schema{
+//			"name": {Type: "string", MinLength: jas.IntPtr(1), MaxLength: jas.IntPtr(60)},
+//			"age":  {Type: "integer", Minimum: jas.FloatPtr(0)},
+//			"tags": {Type: "array", Items: &jas.Schema{Type: "string", Enum: []interface{}{"a", "b"}}},
+//		},
+//	}
+type Schema struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	//One of "object", "array", "string", "integer", "number", "boolean" and "null", any type if empty.
+	Type string        `json:"type,omitempty"`
+	Enum []interface{} `json:"enum,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"` //Only false is checked.
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"` //In number of characters.
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+
+	compileOnce sync.Once
+	regexp      *regexp.Regexp
+	enum        []interface{}
+}
+
+//Implements this interface to validate the request body of resource methods with schemas.
+//The keys of the map are method names, e.g. "Post", "PutName".
+//If the body is invalid, the method is not called and a ValidationError of UnprocessableEntityStatusCode
+//that contains all the violations is responded. A request error of MissingJsonBody or MalformedJsonBody is responded
+//if there is no body or the body can not be decoded.
+//The body is decoded in Finder for the methods that have schema even if Config option `DisableAutoUnmarshal` is set,
+//*Context.Unmarshal decodes from the Finder value then.
+type ResourceWithSchemas interface {
+	Schemas() map[string]*Schema
+}
+
+func IntPtr(i int) *int {
+	return &i
+}
+
+func FloatPtr(f float64) *float64 {
+	return &f
+}
+
+//Validate the value decoded from json, return all the violations.
+//The codes of the violations are made with the Finder error formats, e.g. "photo[0].nameInvalid", "ageOutOfRange".
+func (schema *Schema) Validate(value interface{}) []ErrorBody {
+	return schema.validateValue(nil, false, value)
+}
+
+func (schema *Schema) validateValue(config *Config, text bool, value interface{}) []ErrorBody {
+	var errors []ErrorBody
+	schema.validate(config, text, nil, value, &errors)
+	return errors
+}
+
+//Compile the pattern and normalize the enum values to json decoded values, it panics if the pattern is invalid.
+func (schema *Schema) compile() {
+	schema.compileOnce.Do(func() {
+		if schema.Pattern != "" {
+			schema.regexp = regexp.MustCompile(schema.Pattern)
+		}
+		for _, e := range schema.Enum {
+			value, err := toDocument(e)
+			if err != nil {
+				panic(err)
+			}
+			schema.enum = append(schema.enum, value)
+		}
+		for _, property := range schema.Properties {
+			property.compile()
+		}
+		if schema.Items != nil {
+			schema.Items.compile()
+		}
+	})
+}
+
+func (schema *Schema) validate(config *Config, text bool, path []interface{}, value interface{}, errors *[]ErrorBody) {
+	schema.compile()
+	addError := func(formatKind int, paths ...interface{}) {
+		field := "value"
+		if fullPath := appendPath(path, paths...); len(fullPath) > 0 {
+			field = FormatPath(fullPath...)
+		}
+		code := fmt.Sprintf(config.finderErrorFormats()[formatKind], field)
+		*errors = append(*errors, ErrorBody{Code: code, Message: code, Field: field})
+	}
+	if !schemaTypeMatches(schema.Type, text, value) {
+		addError(invalidFormat)
+		return
+	}
+	if len(schema.enum) > 0 && !schemaEnumContains(schema.enum, text, value) {
+		addError(invalidFormat)
+		return
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range schema.Required {
+			if _, ok := v[key]; !ok {
+				addError(invalidFormat, key)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property := schema.Properties[key]; property != nil {
+				property.validate(config, text, appendPath(path, key), v[key], errors)
+			} else if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				addError(invalidFormat, key)
+			}
+		}
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			addError(tooShortFormat)
+		} else if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			addError(tooLongFormat)
+		}
+		if schema.Items != nil {
+			for i, element := range v {
+				schema.Items.validate(config, text, appendPath(path, i), element, errors)
+			}
+		}
+	case string:
+		if schema.Type == "integer" || schema.Type == "number" {
+			schema.validateNumber(json.Number(v), addError)
+			return
+		}
+		count := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && count < *schema.MinLength {
+			addError(tooShortFormat)
+		} else if schema.MaxLength != nil && count > *schema.MaxLength {
+			addError(tooLongFormat)
+		}
+		if schema.regexp != nil && !schema.regexp.MatchString(v) {
+			addError(invalidFormat)
+		}
+	case json.Number:
+		schema.validateNumber(v, addError)
+	}
+}
+
+func (schema *Schema) validateNumber(num json.Number, addError func(int, ...interface{})) {
+	f, err := num.Float64()
+	if err != nil {
+		addError(invalidFormat)
+		return
+	}
+	if (schema.Minimum != nil && f < *schema.Minimum) || (schema.Maximum != nil && f > *schema.Maximum) ||
+		(schema.ExclusiveMinimum != nil && f <= *schema.ExclusiveMinimum) ||
+		(schema.ExclusiveMaximum != nil && f >= *schema.ExclusiveMaximum) {
+		addError(outOfRangeFormat)
+	}
+}
+
+//Check the type of the value, strings of numbers and booleans match if the body is not json.
+func schemaTypeMatches(schemaType string, text bool, value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return schemaType == "" || schemaType == "null"
+	case map[string]interface{}:
+		return schemaType == "" || schemaType == "object"
+	case []interface{}:
+		return schemaType == "" || schemaType == "array"
+	case bool:
+		return schemaType == "" || schemaType == "boolean"
+	case json.Number:
+		return schemaType == "" || schemaType == "number" || (schemaType == "integer" && isInteger(v))
+	case string:
+		switch schemaType {
+		case "", "string":
+			return true
+		case "number":
+			return text && textNumberRegexp.MatchString(v)
+		case "integer":
+			return text && textNumberRegexp.MatchString(v) && isInteger(json.Number(v))
+		case "boolean":
+			return text && (v == "true" || v == "false")
+		}
+	}
+	return false
+}
+
+//Integers in JSON Schema include numbers with zero fractional part like 1.0.
+func isInteger(num json.Number) bool {
+	if _, err := num.Int64(); err == nil {
+		return true
+	}
+	f, err := num.Float64()
+	return err == nil && f == math.Trunc(f) && !math.IsInf(f, 0)
+}
+
+func schemaEnumContains(enum []interface{}, text bool, value interface{}) bool {
+	for _, e := range enum {
+		if jsonEqual(e, value) {
+			return true
+		}
+		if s, ok := value.(string); ok && text {
+			if _, isString := e.(string); !isString && fmt.Sprint(e) == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Get the schemas of the routes keyed by route like "POST /users/:id", it can be used to generate api documents.
+func (router *Router) RouteSchemas() map[string]*Schema {
+	schemas := make(map[string]*Schema, len(router.schemas))
+	for route, schema := range router.schemas {
+		schemas[route] = schema
+	}
+	return schemas
+}
+
+//Validate the request body with the schema of the route, panic with ValidationError if it is invalid.
+//The body of unknown length, e.g. chunked, is decoded too.
+func (ctx *Context) validateSchema(schema *Schema) {
+	ctx.UnmarshalInFinder()
+	if ctx.Finder.value == nil && ctx.Finder.err == nil && ctx.ContentLength < 0 && ctx.Body != nil && ctx.Body != http.NoBody {
+		if decoder, mediaType := ctx.config.bodyDecoder(ctx.Header.Get("Content-Type")); decoder != nil {
+			ctx.Finder.value, ctx.Finder.err = decoder(ctx.Request)
+			ctx.text = !isJsonMediaType(mediaType)
+		}
+	}
+	if ctx.Finder.value == nil && ctx.Finder.err == nil {
+		panic(RequestError{MissingJsonBody, ctx.config.requestErrorStatusCode()})
+	}
+	if ctx.Finder.err != nil {
+		panic(RequestError{MalformedJsonBody, ctx.config.requestErrorStatusCode()})
+	}
+	if errors := schema.validateValue(ctx.config, ctx.text, ctx.Finder.value); len(errors) > 0 {
+		panic(&ValidationError{errors, UnprocessableEntityStatusCode})
+	}
+}
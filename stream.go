@@ -0,0 +1,156 @@
+package jas
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+)
+
+//Implements this interface to read the json body of the resource methods as a stream, e.g. for bulk import of large arrays.
+//The body of the methods returned by StreamingBodies, e.g. []string{"PostImport"}, is not decoded in Finder,
+//call *Context.StreamArray to decode the elements one at a time instead.
+//Schemas of the methods are not validated because the body is not decoded before the method runs.
+type ResourceWithStreamingBodies interface {
+	StreamingBodies() []string
+}
+
+//Call the function with the Finder of each element of the array in the json body, in order.
+//The key is the key of the array in the top level object, or empty string if the body is the array itself.
+//Errors of Require methods called on the element Finder contain the full path, e.g. "items[3].nameInvalid".
+//It stops and returns the error if the function returns an error.
+//Other errors are RequestErrors: MissingJsonBody if there is no json body, MalformedJsonBody if the body is not valid json,
+//and the Finder invalid error of the key like "itemsInvalid" if the array is not found.
+//
+//For methods returned by ResourceWithStreamingBodies, the elements are decoded from the body one at a time,
+//so it can only be called once, values of other keys before the array are skipped without being kept in memory.
+//The size of the body and the number of elements are not limited, wrap the body with http.MaxBytesReader
+//in BeforeServe or return an error from the function to limit them.
+//For other methods, it iterates the array that has been decoded in Finder.
+//
+//	func (*Products) PostImport(ctx *jas.Context) {
+//		err := ctx.StreamArray("items", func(item jas.Finder) error {
+//			return saveProduct(item.RequireString("name"), item.RequirePositiveInt("price"))
+//		})
+//	}
+func (ctx *Context) StreamArray(key string, fn func(f Finder) error) error {
+	var paths []interface{}
+	if key != "" {
+		paths = append(paths, key)
+	}
+	if ctx.Finder.value != nil || ctx.Finder.err != nil {
+		if ctx.Finder.err != nil {
+			return RequestError{MalformedJsonBody, ctx.config.requestErrorStatusCode()}
+		}
+		array := ctx.Finder.FindChild(paths...)
+		if _, ok := array.value.([]interface{}); array.err != nil || (!ok && !array.text) {
+			return ctx.invalidArrayError(paths)
+		}
+		return ctx.Finder.Each(func(i int, f Finder) error {
+			return fn(f)
+		}, paths...)
+	}
+	mediaType, _, _ := mime.ParseMediaType(ctx.Header.Get("Content-Type"))
+	if ctx.ContentLength == 0 || !isJsonMediaType(mediaType) {
+		return RequestError{MissingJsonBody, ctx.config.requestErrorStatusCode()}
+	}
+	decoder := json.NewDecoder(ctx.Body)
+	decoder.UseNumber()
+	err := ctx.streamArray(decoder, paths, fn)
+	if callbackErr, ok := err.(streamCallbackError); ok {
+		return callbackErr.err
+	}
+	if _, ok := err.(*json.SyntaxError); ok || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return RequestError{MalformedJsonBody, ctx.config.requestErrorStatusCode()}
+	}
+	if err == EntryNotExistsError || err == WrongTypeError {
+		return ctx.invalidArrayError(paths)
+	}
+	return err
+}
+
+//The error returned by the function of StreamArray, to tell it from the errors of the body.
+type streamCallbackError struct {
+	err error
+}
+
+func (sce streamCallbackError) Error() string {
+	return sce.err.Error()
+}
+
+func (ctx *Context) invalidArrayError(paths []interface{}) error {
+	format := ctx.config.finderErrorFormats()[invalidFormat]
+	return RequestError{fmt.Sprintf(format, ctx.Finder.fieldName(paths...)), ctx.config.requestErrorStatusCode()}
+}
+
+func (ctx *Context) streamArray(decoder *json.Decoder, paths []interface{}, fn func(f Finder) error) error {
+	if len(paths) > 0 {
+		if err := expectDelim(decoder, '{'); err != nil {
+			return err
+		}
+		for {
+			if !decoder.More() {
+				return EntryNotExistsError
+			}
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			if token == paths[0] {
+				break
+			}
+			if err = skipValue(decoder); err != nil {
+				return err
+			}
+		}
+	}
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for i := 0; decoder.More(); i++ {
+		var element interface{}
+		if err := decoder.Decode(&element); err != nil {
+			return err
+		}
+		finder := Finder{value: element, config: ctx.config, path: appendPath(paths, i)}
+		if element == nil {
+			finder.err = NullValueError
+		}
+		if err := fn(finder); err != nil {
+			return streamCallbackError{err}
+		}
+	}
+	return expectDelim(decoder, ']')
+}
+
+//Read the next token, return WrongTypeError if it is not the delimiter.
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return WrongTypeError
+	}
+	return nil
+}
+
+//Skip the next value by reading its tokens.
+func skipValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
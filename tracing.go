@@ -0,0 +1,172 @@
+package jas
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//Tracer is notified at each stage of a request, it can be used to report requests to a distributed tracing system.
+//The trace context of the request is available in *Context.Trace when the methods are called.
+type Tracer interface {
+
+	//Called before the resource method, after the trace context has been parsed from the request header.
+	StartRequest(*Context)
+
+	//Called after the resource method has returned or panicked.
+	MethodReturned(*Context)
+
+	//Called after MethodReturned if the request ends with an AppError.
+	OnAppError(*Context, AppError)
+
+	//Called after the response has been written, it is the end of the request.
+	ResponseWritten(*Context)
+}
+
+//TraceContext is the W3C trace context of a request.
+//If the request has a valid "traceparent" header, the request joins the trace, otherwise a new trace is started.
+type TraceContext struct {
+	TraceId      string //32 lowercase hex digits.
+	SpanId       string //16 lowercase hex digits, the id of the span that serves the request.
+	ParentSpanId string //The parent span id in the "traceparent" header, empty if a new trace is started.
+	Flags        byte
+	State        string //The "tracestate" header value.
+}
+
+//Format the "traceparent" header value with SpanId as the parent id.
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceId, tc.SpanId, tc.Flags)
+}
+
+//Set "traceparent" and "tracestate" headers, typically on an outgoing request to propagate the trace.
+func (tc TraceContext) Inject(header http.Header) {
+	header.Set("traceparent", tc.TraceParent())
+	if tc.State != "" {
+		header.Set("tracestate", tc.State)
+	}
+}
+
+//Parse the W3C trace context from the request header, and generate a new span id for the request.
+func ParseTraceContext(header http.Header) TraceContext {
+	var tc TraceContext
+	traceId, parentId, flags, ok := parseTraceParent(header.Get("traceparent"))
+	if ok {
+		tc.TraceId = traceId
+		tc.ParentSpanId = parentId
+		tc.Flags = flags
+		tc.State = strings.Join(header.Values("tracestate"), ",")
+	} else {
+		tc.TraceId = randomHex(16)
+	}
+	tc.SpanId = randomHex(8)
+	return tc
+}
+
+func parseTraceParent(traceParent string) (traceId, parentId string, flags byte, ok bool) {
+	if len(traceParent) < 55 {
+		return
+	}
+	version := traceParent[:2]
+	if !isLowerHex(version) || version == "ff" {
+		return
+	}
+	if version == "00" && len(traceParent) != 55 {
+		return
+	}
+	if len(traceParent) > 55 && traceParent[55] != '-' {
+		return
+	}
+	if traceParent[2] != '-' || traceParent[35] != '-' || traceParent[52] != '-' {
+		return
+	}
+	traceId = traceParent[3:35]
+	parentId = traceParent[36:52]
+	flagsHex := traceParent[53:55]
+	if !isLowerHex(traceId) || !isLowerHex(parentId) || !isLowerHex(flagsHex) {
+		return
+	}
+	if strings.Trim(traceId, "0") == "" || strings.Trim(parentId, "0") == "" {
+		return
+	}
+	flagsBytes, _ := hex.DecodeString(flagsHex)
+	return traceId, parentId, flagsBytes[0], true
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//TraceEvent is a request stage recorded by MemoryTracer.
+type TraceEvent struct {
+	Stage   string //"start", "method", "error" or "written".
+	TraceId string
+	SpanId  string
+	Route   string
+	Status  int
+	Err     AppError
+}
+
+//MemoryTracer is a Tracer implementation that records the events in memory, it is intended to be used in tests.
+type MemoryTracer struct {
+	mu     sync.Mutex
+	events []TraceEvent
+}
+
+func (mt *MemoryTracer) StartRequest(ctx *Context) {
+	mt.record("start", ctx, nil)
+}
+
+func (mt *MemoryTracer) MethodReturned(ctx *Context) {
+	mt.record("method", ctx, nil)
+}
+
+func (mt *MemoryTracer) OnAppError(ctx *Context, err AppError) {
+	mt.record("error", ctx, err)
+}
+
+func (mt *MemoryTracer) ResponseWritten(ctx *Context) {
+	mt.record("written", ctx, nil)
+}
+
+//Get a copy of the recorded events.
+func (mt *MemoryTracer) Events() []TraceEvent {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	return append([]TraceEvent(nil), mt.events...)
+}
+
+//Clear the recorded events.
+func (mt *MemoryTracer) Reset() {
+	mt.mu.Lock()
+	mt.events = nil
+	mt.mu.Unlock()
+}
+
+func (mt *MemoryTracer) record(stage string, ctx *Context, err AppError) {
+	event := TraceEvent{
+		Stage:   stage,
+		TraceId: ctx.Trace.TraceId,
+		SpanId:  ctx.Trace.SpanId,
+		Route:   ctx.route,
+		Status:  ctx.Status,
+		Err:     err,
+	}
+	mt.mu.Lock()
+	mt.events = append(mt.events, event)
+	mt.mu.Unlock()
+}
@@ -0,0 +1,218 @@
+package jas
+
+import (
+	"log/slog"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//Validator has the same Require methods as Finder, but it collects the errors instead of stopping
+//the execution on the first invalid parameter, the Require methods return zero value on error.
+//Call Check after all the parameters have been required to respond all the errors at once.
+//
+//	v := ctx.Validate()
+//	name := v.RequireString("name")
+//	password := v.RequireStringLen(6, 60, "password")
+//	v.Check() // responds `{"data":null,"error":{"code":"nameInvalid",...,"details":[...]}}`
+type Validator struct {
+	finder Finder
+	errors []ErrorBody
+}
+
+//ValidationError is the DetailedError made by *Validator.Check.
+//Code, Message and Field are of the first field error, Details is the list of all the field errors.
+type ValidationError struct {
+	Errors     []ErrorBody
+	StatusCode int
+}
+
+func (ve *ValidationError) Error() string {
+	messages := make([]string, len(ve.Errors))
+	for i, fieldError := range ve.Errors {
+		messages[i] = fieldError.Message
+	}
+	return strings.Join(messages, ",")
+}
+
+func (ve *ValidationError) Status() int {
+	return ve.StatusCode
+}
+
+func (ve *ValidationError) Message() string {
+	return ve.Errors[0].Message
+}
+
+func (ve *ValidationError) Code() string {
+	return ve.Errors[0].Code
+}
+
+func (ve *ValidationError) Field() string {
+	return ve.Errors[0].Field
+}
+
+func (ve *ValidationError) Details() interface{} {
+	return ve.Errors
+}
+
+func (ve *ValidationError) Log(context *Context) {
+	doLog(context.config.RequestErrorLogger, slog.LevelWarn, context, ve, nil)
+}
+
+//Get a Validator to validate multiple parameters at once.
+func (finder Finder) Validate() *Validator {
+	return &Validator{finder: finder}
+}
+
+//Get the collected field errors.
+func (v *Validator) Errors() []ErrorBody {
+	return v.errors
+}
+
+//Add a field error, it can be used for validations that Require methods can not do.
+func (v *Validator) AddError(field, message string) {
+	v.errors = append(v.errors, ErrorBody{Code: message, Message: message, Field: field})
+}
+
+//Panic with a ValidationError that contains all the field errors if any Require method failed.
+func (v *Validator) Check() {
+	if len(v.errors) > 0 {
+		panic(&ValidationError{v.errors, v.finder.config.requestErrorStatusCode()})
+	}
+}
+
+//Call the Finder Require method, record the RequestError if it panics.
+func (v *Validator) require(paths []interface{}, requireFunc func()) {
+	defer func() {
+		if x := recover(); x != nil {
+			requestError, ok := x.(RequestError)
+			if !ok {
+				panic(x)
+			}
+			v.AddError(v.finder.fieldName(paths...), requestError.Msg)
+		}
+	}()
+	requireFunc()
+}
+
+func (v *Validator) RequireString(paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireString(paths...) })
+	return
+}
+
+func (v *Validator) RequireStringLen(min, max int, paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireStringLen(min, max, paths...) })
+	return
+}
+
+func (v *Validator) RequireStringRuneLen(min, max int, paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireStringRuneLen(min, max, paths...) })
+	return
+}
+
+func (v *Validator) RequireStringMatch(reg *regexp.Regexp, paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireStringMatch(reg, paths...) })
+	return
+}
+
+func (v *Validator) RequireSlice(paths ...interface{}) (s []interface{}) {
+	v.require(paths, func() { s = v.finder.RequireSlice(paths...) })
+	return
+}
+
+func (v *Validator) RequireMap(paths ...interface{}) (m map[string]interface{}) {
+	v.require(paths, func() { m = v.finder.RequireMap(paths...) })
+	return
+}
+
+func (v *Validator) RequireInt(paths ...interface{}) (i int64) {
+	v.require(paths, func() { i = v.finder.RequireInt(paths...) })
+	return
+}
+
+func (v *Validator) RequirePositiveInt(paths ...interface{}) (i int64) {
+	v.require(paths, func() { i = v.finder.RequirePositiveInt(paths...) })
+	return
+}
+
+func (v *Validator) RequireFloat(paths ...interface{}) (f float64) {
+	v.require(paths, func() { f = v.finder.RequireFloat(paths...) })
+	return
+}
+
+func (v *Validator) RequirePositiveFloat(paths ...interface{}) (f float64) {
+	v.require(paths, func() { f = v.finder.RequirePositiveFloat(paths...) })
+	return
+}
+
+func (v *Validator) RequireTime(paths ...interface{}) (t time.Time) {
+	v.require(paths, func() { t = v.finder.RequireTime(paths...) })
+	return
+}
+
+func (v *Validator) RequireDuration(paths ...interface{}) (d time.Duration) {
+	v.require(paths, func() { d = v.finder.RequireDuration(paths...) })
+	return
+}
+
+func (v *Validator) RequireUint(paths ...interface{}) (u uint64) {
+	v.require(paths, func() { u = v.finder.RequireUint(paths...) })
+	return
+}
+
+func (v *Validator) RequireIntRange(min, max int64, paths ...interface{}) (i int64) {
+	v.require(paths, func() { i = v.finder.RequireIntRange(min, max, paths...) })
+	return
+}
+
+func (v *Validator) RequireEnum(allowed []string, paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireEnum(allowed, paths...) })
+	return
+}
+
+func (v *Validator) RequireUUID(paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireUUID(paths...) })
+	return
+}
+
+func (v *Validator) RequireEmail(paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireEmail(paths...) })
+	return
+}
+
+func (v *Validator) RequireURL(paths ...interface{}) (u *url.URL) {
+	v.require(paths, func() { u = v.finder.RequireURL(paths...) })
+	return
+}
+
+func (v *Validator) RequireStrings(paths ...interface{}) (strs []string) {
+	v.require(paths, func() { strs = v.finder.RequireStrings(paths...) })
+	return
+}
+
+func (v *Validator) RequireInts(paths ...interface{}) (ints []int64) {
+	v.require(paths, func() { ints = v.finder.RequireInts(paths...) })
+	return
+}
+
+func (v *Validator) RequireValid(name string, paths ...interface{}) (value interface{}) {
+	v.require(paths, func() { value = v.finder.RequireValid(name, paths...) })
+	return
+}
+
+func (v *Validator) RequireBigInt(paths ...interface{}) (i *big.Int) {
+	v.require(paths, func() { i = v.finder.RequireBigInt(paths...) })
+	return
+}
+
+func (v *Validator) RequireBigFloat(paths ...interface{}) (f *big.Float) {
+	v.require(paths, func() { f = v.finder.RequireBigFloat(paths...) })
+	return
+}
+
+func (v *Validator) RequireDecimal(paths ...interface{}) (s string) {
+	v.require(paths, func() { s = v.finder.RequireDecimal(paths...) })
+	return
+}
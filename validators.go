@@ -0,0 +1,230 @@
+package jas
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//ValidatorFunc validates a value, returns nil if it is valid.
+//The value is the form string or the json decoded value when called by Finder methods,
+//and the field value when called for struct tags.
+//Return a ValidationCode to use your own error code instead of InvalidErrorFormat.
+type ValidatorFunc func(value interface{}) error
+
+//ValidationCode is the error code returned by ValidatorFunc.
+//If it contains "%v", it is formatted with the field name like the Finder error formats, e.g. "%vInvalidPhone".
+type ValidationCode string
+
+func (vc ValidationCode) Error() string {
+	return string(vc)
+}
+
+var validatorsMutex sync.RWMutex
+
+var validators = map[string]ValidatorFunc{
+	"email": validateEmail,
+	"uuid":  validateUUID,
+	"url":   validateURL,
+}
+
+//Register the validator for all routers, it is usually called in init functions.
+//Built-in validators are "email", "uuid" and "url".
+func RegisterValidator(name string, validator ValidatorFunc) {
+	validatorsMutex.Lock()
+	validators[name] = validator
+	validatorsMutex.Unlock()
+}
+
+//Register the validator for the router only, it takes precedence over the validator registered by package level function.
+//It should be called before the router starts to serve.
+func (config *Config) RegisterValidator(name string, validator ValidatorFunc) {
+	if config.Validators == nil {
+		config.Validators = map[string]ValidatorFunc{}
+	}
+	config.Validators[name] = validator
+}
+
+//Get the validator of the name, it panics if the validator is not registered.
+func (config *Config) validator(name string) ValidatorFunc {
+	if config != nil {
+		if validator := config.Validators[name]; validator != nil {
+			return validator
+		}
+	}
+	validatorsMutex.RLock()
+	validator := validators[name]
+	validatorsMutex.RUnlock()
+	if validator == nil {
+		panic("jas: validator not registered: " + name)
+	}
+	return validator
+}
+
+//Get the error message of the field that failed validation.
+func (config *Config) validationMessage(err error, field string) string {
+	if code, ok := err.(ValidationCode); ok {
+		if strings.Contains(string(code), "%v") {
+			return fmt.Sprintf(string(code), field)
+		}
+		return string(code)
+	}
+	return fmt.Sprintf(config.finderErrorFormats()[invalidFormat], field)
+}
+
+//Get the value and validate it with the registered validator of the name.
+//The value is the form string or the json decoded value.
+func (finder Finder) FindValid(name string, paths ...interface{}) (interface{}, error) {
+	value, err := finder.findValue(paths...)
+	if err != nil {
+		return nil, err
+	}
+	if err = finder.config.validator(name)(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+//The message of the RequestError is made by the ValidationCode if the validator returns one.
+//
+//	jas.RegisterValidator("phone", func(value interface{}) error {
+//		if s, _ := value.(string); !phoneRegexp.MatchString(s) {
+//			return jas.ValidationCode("%vInvalidPhone")
+//		}
+//		return nil
+//	})
+//	mobile := ctx.RequireValid("phone", "mobile").(string) // panics with "mobileInvalidPhone"
+func (finder Finder) RequireValid(name string, paths ...interface{}) interface{} {
+	value, err := finder.findValue(paths...)
+	if err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	if err = finder.config.validator(name)(value); err != nil {
+		panic(RequestError{finder.config.validationMessage(err, finder.fieldName(paths...)), finder.config.requestErrorStatusCode()})
+	}
+	return value
+}
+
+//Get the form string or the json decoded value that is not null.
+func (finder Finder) findValue(paths ...interface{}) (interface{}, error) {
+	if s := finder.findFormString(paths...); s != "" {
+		return s, nil
+	}
+	finder = finder.FindChild(paths...)
+	return finder.value, finder.err
+}
+
+//Decode the value into the struct pointed by v, then validate the fields that have "validate" tag
+//with the registered validators, e.g. `validate:"phone"`, multiple validators are separated by comma.
+//Put "omitempty" first to skip the validators if the field is zero value, e.g. `validate:"omitempty,email"`.
+//Nested structs and slices of structs are validated too.
+//It panics with a ValidationError of UnprocessableEntityStatusCode that contains all the violations if any field is invalid,
+//the same as the schema violations of ResourceWithSchemas.
+//Validator names are looked up when the struct is validated, it panics if a name is not registered,
+//which is responded as an InternalError.
+//
+//	type User struct {
+//		Mobile string `json:"mobile" validate:"phone"`
+//		Email  string `json:"email" validate:"omitempty,email"`
+//	}
+//	var user User
+//	ctx.RequireStruct(&user, "user")
+func (finder Finder) RequireStruct(v interface{}, paths ...interface{}) {
+	if err := finder.Decode(v, paths...); err != nil {
+		finder.doPanic(invalidFormat, paths...)
+	}
+	var errors []ErrorBody
+	validateStruct(finder.config, reflect.ValueOf(v), appendPath(finder.path, paths...), &errors)
+	if len(errors) > 0 {
+		panic(&ValidationError{errors, UnprocessableEntityStatusCode})
+	}
+}
+
+//Validate the fields that have "validate" tag with the validators registered by package level function RegisterValidator.
+func ValidateStruct(v interface{}) []ErrorBody {
+	var errors []ErrorBody
+	validateStruct(nil, reflect.ValueOf(v), nil, &errors)
+	return errors
+}
+
+func validateStruct(config *Config, value reflect.Value, path []interface{}, errors *[]ErrorBody) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validateStruct(config, value.Index(i), appendPath(path, i), errors)
+		}
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if jsonName := strings.Split(tag, ",")[0]; jsonName != "" {
+				name = jsonName
+			}
+		}
+		fieldPath := appendPath(path, name)
+		if tag := field.Tag.Get("validate"); tag != "" {
+			validatorNames := strings.Split(tag, ",")
+			if strings.TrimSpace(validatorNames[0]) == "omitempty" {
+				validatorNames = validatorNames[1:]
+				if value.Field(i).IsZero() {
+					validatorNames = nil
+				}
+			}
+			for _, validatorName := range validatorNames {
+				if err := config.validator(strings.TrimSpace(validatorName))(value.Field(i).Interface()); err != nil {
+					fieldName := FormatPath(fieldPath...)
+					message := config.validationMessage(err, fieldName)
+					*errors = append(*errors, ErrorBody{Code: message, Message: message, Field: fieldName})
+					break
+				}
+			}
+		}
+		validateStruct(config, value.Field(i), fieldPath, errors)
+	}
+}
+
+func validateEmail(value interface{}) error {
+	s, _ := value.(string)
+	address, err := mail.ParseAddress(s)
+	if err != nil || address.Name != "" || address.Address != s {
+		return DoNotMatchError
+	}
+	return nil
+}
+
+func validateUUID(value interface{}) error {
+	if s, _ := value.(string); !uuidRegexp.MatchString(s) {
+		return DoNotMatchError
+	}
+	return nil
+}
+
+func validateURL(value interface{}) error {
+	s, _ := value.(string)
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return DoNotMatchError
+	}
+	return nil
+}